@@ -0,0 +1,202 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: calculator.proto
+
+package calculatorpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Calculator_Calculate_FullMethodName       = "/calculator.v1.Calculator/Calculate"
+	Calculator_CalculateBatch_FullMethodName  = "/calculator.v1.Calculator/CalculateBatch"
+	Calculator_CalculateStream_FullMethodName = "/calculator.v1.Calculator/CalculateStream"
+)
+
+// CalculatorClient is the client API for Calculator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Calculator computes expressions like POST /api/v1/calculate.
+type CalculatorClient interface {
+	// Calculate fails with INVALID_ARGUMENT and an Error detail if the
+	// expression cannot be computed.
+	Calculate(ctx context.Context, in *CalculateRequest, opts ...grpc.CallOption) (*CalculateResponse, error)
+	CalculateBatch(ctx context.Context, in *CalculateBatchRequest, opts ...grpc.CallOption) (*CalculateBatchResponse, error)
+	// CalculateStream answers every request in the order they are sent.
+	CalculateStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CalculateRequest, CalculateResponse], error)
+}
+
+type calculatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCalculatorClient(cc grpc.ClientConnInterface) CalculatorClient {
+	return &calculatorClient{cc}
+}
+
+func (c *calculatorClient) Calculate(ctx context.Context, in *CalculateRequest, opts ...grpc.CallOption) (*CalculateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CalculateResponse)
+	err := c.cc.Invoke(ctx, Calculator_Calculate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calculatorClient) CalculateBatch(ctx context.Context, in *CalculateBatchRequest, opts ...grpc.CallOption) (*CalculateBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CalculateBatchResponse)
+	err := c.cc.Invoke(ctx, Calculator_CalculateBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *calculatorClient) CalculateStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CalculateRequest, CalculateResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Calculator_ServiceDesc.Streams[0], Calculator_CalculateStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CalculateRequest, CalculateResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Calculator_CalculateStreamClient = grpc.BidiStreamingClient[CalculateRequest, CalculateResponse]
+
+// CalculatorServer is the server API for Calculator service.
+// All implementations must embed UnimplementedCalculatorServer
+// for forward compatibility.
+//
+// Calculator computes expressions like POST /api/v1/calculate.
+type CalculatorServer interface {
+	// Calculate fails with INVALID_ARGUMENT and an Error detail if the
+	// expression cannot be computed.
+	Calculate(context.Context, *CalculateRequest) (*CalculateResponse, error)
+	CalculateBatch(context.Context, *CalculateBatchRequest) (*CalculateBatchResponse, error)
+	// CalculateStream answers every request in the order they are sent.
+	CalculateStream(grpc.BidiStreamingServer[CalculateRequest, CalculateResponse]) error
+	mustEmbedUnimplementedCalculatorServer()
+}
+
+// UnimplementedCalculatorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCalculatorServer struct{}
+
+func (UnimplementedCalculatorServer) Calculate(context.Context, *CalculateRequest) (*CalculateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Calculate not implemented")
+}
+func (UnimplementedCalculatorServer) CalculateBatch(context.Context, *CalculateBatchRequest) (*CalculateBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CalculateBatch not implemented")
+}
+func (UnimplementedCalculatorServer) CalculateStream(grpc.BidiStreamingServer[CalculateRequest, CalculateResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CalculateStream not implemented")
+}
+func (UnimplementedCalculatorServer) mustEmbedUnimplementedCalculatorServer() {}
+func (UnimplementedCalculatorServer) testEmbeddedByValue()                    {}
+
+// UnsafeCalculatorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CalculatorServer will
+// result in compilation errors.
+type UnsafeCalculatorServer interface {
+	mustEmbedUnimplementedCalculatorServer()
+}
+
+func RegisterCalculatorServer(s grpc.ServiceRegistrar, srv CalculatorServer) {
+	// If the following call pancis, it indicates UnimplementedCalculatorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Calculator_ServiceDesc, srv)
+}
+
+func _Calculator_Calculate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalculateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).Calculate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calculator_Calculate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).Calculate(ctx, req.(*CalculateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calculator_CalculateBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalculateBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CalculatorServer).CalculateBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Calculator_CalculateBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CalculatorServer).CalculateBatch(ctx, req.(*CalculateBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Calculator_CalculateStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CalculatorServer).CalculateStream(&grpc.GenericServerStream[CalculateRequest, CalculateResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Calculator_CalculateStreamServer = grpc.BidiStreamingServer[CalculateRequest, CalculateResponse]
+
+// Calculator_ServiceDesc is the grpc.ServiceDesc for Calculator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Calculator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "calculator.v1.Calculator",
+	HandlerType: (*CalculatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Calculate",
+			Handler:    _Calculator_Calculate_Handler,
+		},
+		{
+			MethodName: "CalculateBatch",
+			Handler:    _Calculator_CalculateBatch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CalculateStream",
+			Handler:       _Calculator_CalculateStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "calculator.proto",
+}
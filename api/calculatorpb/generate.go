@@ -0,0 +1,4 @@
+// Package calculatorpb is the gRPC API of the calculator.
+package calculatorpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative calculator.proto
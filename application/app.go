@@ -0,0 +1,153 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"google.golang.org/grpc"
+)
+
+// App is the calculator server: the HTTP API and, if configured, the gRPC
+// service.
+type App struct {
+	config        Config
+	server        *http.Server
+	grpc_server   *grpc.Server
+	expressions   *Expressions
+	health        *Health
+	logger        *slog.Logger
+	listener      net.Listener
+	grpc_listener net.Listener
+}
+
+func NewApp(config Config) *App {
+	app := &App{
+		config:      config,
+		expressions: NewExpressions(NewMemoryStore(), config.BatchWorkers, config.QueueSize),
+		health:      NewHealth(NewEvaluator(config.MaxExpressionLength)),
+		logger:      NewLogger(os.Stderr, config),
+	}
+	app.server = &http.Server{
+		Addr:         config.Address,
+		Handler:      newHandler(config, app.expressions, app.logger, NewMetrics(), app.health),
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	}
+	if config.GRPCAddress != "" {
+		app.grpc_server = NewGRPCServer(config)
+	}
+	return app
+}
+
+// Listen binds the addresses of the servers; Run calls it if it was not
+// called before.
+func (a *App) Listen() error {
+	if a.listener != nil {
+		return nil
+	}
+	listener, err := net.Listen("tcp", a.config.Address)
+	if err != nil {
+		return err
+	}
+	if a.grpc_server != nil {
+		a.grpc_listener, err = net.Listen("tcp", a.config.GRPCAddress)
+		if err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	a.listener = listener
+	return nil
+}
+
+// Addr returns the address the HTTP server listens on once Listen is done.
+func (a *App) Addr() net.Addr {
+	return a.listener.Addr()
+}
+
+// GRPCAddr returns the address of the gRPC server, nil if it is disabled.
+func (a *App) GRPCAddr() net.Addr {
+	if a.grpc_listener == nil {
+		return nil
+	}
+	return a.grpc_listener.Addr()
+}
+
+// Run serves requests until ctx is done, then shuts the servers down
+// giving in-flight requests Config.ShutdownTimeout to finish. It returns
+// an error if a server fails or the requests are not finished in time.
+func (a *App) Run(ctx context.Context) error {
+	if err := a.Listen(); err != nil {
+		return err
+	}
+	errs := make(chan error, 2)
+	go func() {
+		errs <- a.server.Serve(a.listener)
+	}()
+	if a.grpc_server != nil {
+		go func() {
+			errs <- a.grpc_server.Serve(a.grpc_listener)
+		}()
+	}
+	if a.grpc_server != nil {
+		a.logger.Info("server started", "address", a.Addr().String(), "grpc_address", a.GRPCAddr().String())
+	} else {
+		a.logger.Info("server started", "address", a.Addr().String())
+	}
+	var err error
+	select {
+	case err = <-errs:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	case <-ctx.Done():
+	}
+	a.logger.Info("server stopping", "shutdown_timeout", a.config.ShutdownTimeout)
+	shutdown_ctx, cancel := context.WithTimeout(context.Background(), a.config.ShutdownTimeout)
+	defer cancel()
+	return errors.Join(err, a.Shutdown(shutdown_ctx))
+}
+
+// Shutdown makes the server not ready, stops accepting requests and waits
+// until the in-flight ones and the asynchronous expressions are finished or
+// ctx is done, in which case the remaining connections are closed.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.health.Stop()
+	err := a.server.Shutdown(ctx)
+	if err != nil {
+		a.server.Close()
+	}
+	// Serve may not have taken the listener over yet.
+	if a.listener != nil {
+		a.listener.Close()
+	}
+	if a.grpc_server != nil {
+		stopped := make(chan struct{})
+		go func() {
+			a.grpc_server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			a.grpc_server.Stop()
+			err = ctx.Err()
+		}
+	}
+	finished := make(chan struct{})
+	go func() {
+		a.expressions.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestApp returns an App on random ports whose /slow endpoint answers
+// after delay, signalling started when a request comes in.
+func newTestApp(t *testing.T, shutdown_timeout time.Duration, delay time.Duration) (*App, chan struct{}) {
+	config := DefaultConfig()
+	config.Address = "127.0.0.1:0"
+	config.GRPCAddress = "127.0.0.1:0"
+	config.ShutdownTimeout = shutdown_timeout
+	app := NewApp(config)
+	started := make(chan struct{}, 1)
+	mux := http.NewServeMux()
+	mux.Handle("/", app.server.Handler)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		time.Sleep(delay)
+		w.Write([]byte("done"))
+	})
+	app.server.Handler = mux
+	if err := app.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	return app, started
+}
+
+func TestAppServes(t *testing.T) {
+	app, _ := newTestApp(t, time.Second, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- app.Run(ctx)
+	}()
+	res, err := http.Post("http://"+app.Addr().String()+"/api/v1/calculate", "application/json", bytes.NewBufferString(`{"expression":"2+2*2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != `{"result":6}` {
+		t.Fatalf("app answered %s", body)
+	}
+	if app.GRPCAddr() == nil {
+		t.Fatalf("gRPC server is not listening")
+	}
+	cancel()
+	if err := <-stopped; err != nil {
+		t.Fatalf("Run returned %v", err)
+	}
+	if _, err := http.Get("http://" + app.Addr().String() + "/api/v1/functions"); err == nil {
+		t.Fatalf("app serves requests after shutdown")
+	}
+}
+
+func TestAppDrainsRequests(t *testing.T) {
+	app, started := newTestApp(t, 5*time.Second, 200*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- app.Run(ctx)
+	}()
+	answered := make(chan string)
+	go func() {
+		res, err := http.Get("http://" + app.Addr().String() + "/slow")
+		if err != nil {
+			answered <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		answered <- string(body)
+	}()
+	<-started
+	cancel()
+	for app.health.check() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	if err := app.health.check(); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("app is not ready with %v while shutting down", err)
+	}
+	if body := <-answered; body != "done" {
+		t.Fatalf("in-flight request answered with %q", body)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("Run returned %v", err)
+	}
+}
+
+func TestAppShutdownDeadline(t *testing.T) {
+	app, started := newTestApp(t, 50*time.Millisecond, time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error)
+	go func() {
+		stopped <- app.Run(ctx)
+	}()
+	go http.Get("http://" + app.Addr().String() + "/slow")
+	<-started
+	start := time.Now()
+	cancel()
+	if err := <-stopped; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run returned %v want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("shutdown waited for the request for %v", elapsed)
+	}
+}
+
+func TestAppListenError(t *testing.T) {
+	first, _ := newTestApp(t, time.Second, 0)
+	defer first.listener.Close()
+	config := DefaultConfig()
+	config.Address = first.Addr().String()
+	if err := NewApp(config).Run(context.Background()); err == nil {
+		t.Fatalf("Run succeeded on a busy address")
+	}
+}
@@ -3,29 +3,71 @@ package application
 import (
 	"encoding/json"
 	"errors"
+	"log/slog"
+	"math"
 	"net/http"
+	"os"
+	"unicode/utf8"
 
 	"github.com/Varman56/CalcServer.git/pkg/calculator"
 )
 
 type Request struct {
-	Expression string `json:"expression"`
+	Expression string             `json:"expression"`
+	Variables  map[string]float64 `json:"variables,omitempty"`
+	Mode       string             `json:"mode,omitempty"`
+	Precision  uint               `json:"precision,omitempty"`
+	Typed      bool               `json:"typed,omitempty"`
+	Unsigned   bool               `json:"unsigned,omitempty"`
+	Format     string             `json:"format,omitempty"`
 }
 
 type AnswerOk struct {
-	Result float64 `json:"result"`
+	Result        interface{} `json:"result"`
+	Approximation *float64    `json:"approximation,omitempty"`
+}
+
+type ComplexResult struct {
+	Re float64 `json:"re"`
+	Im float64 `json:"im"`
 }
 
 type AnswerBad struct {
-	Error string `json:"error"`
+	Error    string   `json:"error"`
+	Position *int     `json:"position,omitempty"`
+	Token    string   `json:"token,omitempty"`
+	Expected []string `json:"expected,omitempty"`
+}
+
+type FunctionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MinArgs     int    `json:"min_args"`
+	MaxArgs     int    `json:"max_args"`
+}
+
+type AnswerFunctions struct {
+	Functions []FunctionInfo `json:"functions"`
 }
 
 var (
-	ErrInvalidInput = errors.New("invalid json request")
-	ErrServer       = errors.New("internal server error")
-	ErrPartsWrtie   = errors.New("wrtied only part of data")
+	ErrInvalidInput  = errors.New("invalid json request")
+	ErrServer        = errors.New("internal server error")
+	ErrPartsWrtie    = errors.New("wrtied only part of data")
+	ErrUnknownFormat = errors.New("unknown integer output format")
+	// ErrExpressionTooLong is returned for expressions longer than
+	// Config.MaxExpressionLength.
+	ErrExpressionTooLong = errors.New("expression is too long")
 )
 
+var integerBases = map[string]int{
+	"":    10,
+	"dec": 10,
+	"hex": 16,
+	"bin": 2,
+	"oct": 8,
+}
+
 var errorsToCheck = []error{
 	calculator.ErrInvalidExpression,
 	calculator.ErrDivisionByZero,
@@ -33,25 +75,82 @@ var errorsToCheck = []error{
 	calculator.ErrMultipleOperands,
 	calculator.ErrConvertingToFloat64,
 	calculator.ErrUndefinedOperand,
+	calculator.ErrInvalidPower,
+	calculator.ErrModuloByZero,
+	calculator.ErrUnknownFunction,
+	calculator.ErrTooFewArguments,
+	calculator.ErrTooManyArguments,
+	calculator.ErrFunctionDomain,
+	calculator.ErrUnboundIdentifier,
+	calculator.ErrReservedName,
+	calculator.ErrMalformedExponent,
+	calculator.ErrInvalidDigit,
+	calculator.ErrMisplacedSeparator,
+	calculator.ErrUnknownMode,
+	calculator.ErrInvalidPrecision,
+	calculator.ErrUnsupportedInMode,
+	calculator.ErrIrrational,
+	calculator.ErrNotInteger,
+	calculator.ErrIntegerOverflow,
+	calculator.ErrInvalidShift,
+	calculator.ErrInvalidDefinition,
+	calculator.ErrRecursionDepth,
+	calculator.ErrTooManySteps,
+	calculator.ErrNoResult,
+	calculator.ErrOverflow,
 }
 
-func TryMarshalError(e error) ([]byte, int) {
+func makeError(e error) AnswerBad {
 	res := AnswerBad{Error: e.Error()}
+	var syntaxErr *calculator.SyntaxError
+	if errors.As(e, &syntaxErr) {
+		res.Position = &syntaxErr.Position
+		res.Token = syntaxErr.Token
+		res.Expected = syntaxErr.Expected
+	}
+	return res
+}
+
+// TryMarshalError returns the JSON answer to e and the status of its type.
+func TryMarshalError(e error) ([]byte, int) {
+	res := makeError(e)
 	jsonBytes, err_dec := json.Marshal(res)
 	if err_dec != nil {
 		ans := AnswerBad{Error: ErrServer.Error()}
 		errBytes, _ := json.Marshal(ans)
 		return errBytes, http.StatusInternalServerError
 	}
-	status := http.StatusUnprocessableEntity
-	if res.Error == "internal server error" || res.Error == "wrtied only part of data" || res.Error == "invalid json request" {
-		status = http.StatusInternalServerError
+	return jsonBytes, httpStatus(e)
+}
+
+func makeAnswer(result calculator.Result, request *Request) AnswerOk {
+	if request.Typed && result.Boolean {
+		return AnswerOk{Result: result.Float != 0}
+	}
+	switch result.Mode {
+	case calculator.ModeDecimal:
+		return AnswerOk{Result: result.String()}
+	case calculator.ModeRational:
+		// Values out of the float64 range have no approximation, as JSON
+		// cannot hold an infinity.
+		if math.IsInf(result.Float, 0) {
+			return AnswerOk{Result: result.String()}
+		}
+		return AnswerOk{Result: result.String(), Approximation: &result.Float}
+	case calculator.ModeComplex:
+		return AnswerOk{Result: ComplexResult{Re: real(result.Complex), Im: imag(result.Complex)}}
+	case calculator.ModeInteger:
+		if base := integerBases[request.Format]; base != 10 {
+			return AnswerOk{Result: result.Text(base)}
+		}
+		return AnswerOk{Result: json.Number(result.String())}
+	default:
+		return AnswerOk{Result: result.Float}
 	}
-	return jsonBytes, status
 }
 
-func TryMarshalData(num float64) ([]byte, int) {
-	res := AnswerOk{Result: num}
+func TryMarshalData(result calculator.Result, request *Request) ([]byte, int) {
+	res := makeAnswer(result, request)
 	jsonBytes, err_dec := json.Marshal(res)
 	if err_dec != nil {
 		ans := AnswerBad{Error: ErrServer.Error()}
@@ -61,50 +160,140 @@ func TryMarshalData(num float64) ([]byte, int) {
 	return jsonBytes, -1
 }
 
-func CalcHandler(w http.ResponseWriter, r *http.Request) {
-	request := new(Request)
-	defer r.Body.Close()
-	w.Header().Set("Content-Type", "application/json")
-	err := json.NewDecoder(r.Body).Decode(&request)
-	if err != nil {
-		jsonBytes, status := TryMarshalError(ErrInvalidInput)
-		http.Error(w, string(jsonBytes), status)
-		return
+// calculate checks and computes the request. Errors that are not caused
+// by the expression are replaced with ErrServer.
+func calculate(request *Request) (calculator.Result, error) {
+	if _, ok := integerBases[request.Format]; !ok {
+		return calculator.Result{}, ErrUnknownFormat
 	}
-
-	result, err := calculator.Calc(request.Expression)
+	result, err := compute(request)
 	if err != nil {
 		for _, errToCheck := range errorsToCheck {
 			if errors.Is(err, errToCheck) {
-				jsonBytes, status := TryMarshalError(err)
-				http.Error(w, string(jsonBytes), status)
-				return
+				return calculator.Result{}, err
 			}
 		}
-		jsonBytes, status := TryMarshalError(ErrServer)
-		http.Error(w, string(jsonBytes), status)
+		return calculator.Result{}, ErrServer
+	}
+	return result, nil
+}
+
+// NewEvaluator returns the Evaluator of the handlers, which rejects
+// expressions longer than max_length runes.
+func NewEvaluator(max_length int) Evaluator {
+	return func(request *Request) (calculator.Result, error) {
+		if utf8.RuneCountInString(request.Expression) > max_length {
+			return calculator.Result{}, ErrExpressionTooLong
+		}
+		return calculate(request)
+	}
+}
+
+// compute evaluates the request, taking float mode expressions from the
+// compiled program cache.
+func compute(request *Request) (calculator.Result, error) {
+	mode := calculator.Mode(request.Mode)
+	if mode != "" && mode != calculator.ModeFloat {
+		return calculator.Evaluate(request.Expression, calculator.Options{
+			Mode:      mode,
+			Precision: request.Precision,
+			Unsigned:  request.Unsigned,
+			Variables: request.Variables,
+		})
+	}
+	program, err := programs.Get(request.Expression)
+	if err != nil {
+		return calculator.Result{}, err
+	}
+	value, err := program.Eval(request.Variables)
+	if err != nil {
+		return calculator.Result{}, err
+	}
+	return calculator.Result{Mode: calculator.ModeFloat, Float: value, Boolean: program.Boolean()}, nil
+}
+
+// CalcHandler computes requests with the default limits.
+var CalcHandler = NewCalcHandler(NewEvaluator(DefaultMaxExpressionLength))
+
+func NewCalcHandler(evaluate Evaluator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		calcHandler(evaluate, w, r)
+	}
+}
+
+func calcHandler(evaluate Evaluator, w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, ErrMethodNotAllowed)
 		return
 	}
-	jsonBytes, status := TryMarshalData(result)
-	if status != -1 {
-		http.Error(w, string(jsonBytes), status)
+	request := new(Request)
+	if err := decodeJSON(r, request); err != nil {
+		noteError(r, err)
+		writeError(w, err)
 		return
 	}
-	n, err := w.Write(jsonBytes)
+
+	result, err := evaluate(request)
+	noteRequest(r, request.Expression, result, err)
 	if err != nil {
-		jsonBytes, status := TryMarshalError(ErrServer)
-		http.Error(w, string(jsonBytes), status)
+		writeError(w, err)
 		return
 	}
-	if n != len(jsonBytes) {
-		jsonBytes, status := TryMarshalError(ErrPartsWrtie)
-		http.Error(w, string(jsonBytes), status)
-		return
+	writeJSON(w, http.StatusOK, makeAnswer(result, request))
+}
+
+func FunctionsHandler(w http.ResponseWriter, r *http.Request) {
+	functions := calculator.Functions()
+	answer := AnswerFunctions{Functions: make([]FunctionInfo, len(functions))}
+	for i, function := range functions {
+		answer.Functions[i] = FunctionInfo{
+			Name:        function.Name,
+			Description: function.Description,
+			MinArgs:     function.MinArgs,
+			MaxArgs:     function.MaxArgs,
+		}
+	}
+	writeJSON(w, http.StatusOK, answer)
+}
+
+// limitBody makes reading more than max_size bytes of the request body
+// fail.
+func limitBody(max_size int64, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, max_size)
+		handler(w, r)
 	}
-	w.WriteHeader(http.StatusOK)
 }
 
-func RunServer() error {
-	http.HandleFunc("/api/v1/calculate", CalcHandler)
-	return http.ListenAndServe(":8080", nil)
+// NewHandler returns the HTTP API limited by config, logging requests to
+// stderr. The stream endpoint is exempt from the body size limit, it limits
+// every line instead.
+func NewHandler(config Config) http.Handler {
+	health := NewHealth(NewEvaluator(config.MaxExpressionLength))
+	return newHandler(config, NewExpressions(NewMemoryStore(), config.BatchWorkers, config.QueueSize), NewLogger(os.Stderr, config), NewMetrics(), health)
+}
+
+func newHandler(config Config, expressions *Expressions, logger *slog.Logger, metrics *Metrics, health *Health) http.Handler {
+	evaluate := metrics.Evaluator(NewEvaluator(config.MaxExpressionLength))
+	expressions.Evaluate = evaluate
+	mux := http.NewServeMux()
+	handleMethods(mux, "/api/v1/calculate", map[string]http.HandlerFunc{
+		http.MethodPost: metrics.Instrument(limitBody(config.MaxBodySize, NewCalcHandler(evaluate))),
+	})
+	handleMethods(mux, "/api/v1/calculate/batch", map[string]http.HandlerFunc{
+		http.MethodPost: limitBody(config.MaxBodySize, NewBatchHandler(evaluate, config.BatchWorkers, config.MaxBatchSize)),
+	})
+	handleMethods(mux, "/api/v1/calculate/stream", map[string]http.HandlerFunc{
+		http.MethodPost: NewStreamHandler(evaluate, config.BatchWorkers),
+	})
+	handleMethods(mux, "/api/v1/functions", map[string]http.HandlerFunc{http.MethodGet: FunctionsHandler})
+	expressions.Register(mux, config.MaxBodySize)
+	handleMethods(mux, "/metrics", map[string]http.HandlerFunc{http.MethodGet: metrics.Handler})
+	handleMethods(mux, "/healthz", map[string]http.HandlerFunc{http.MethodGet: HealthHandler})
+	handleMethods(mux, "/readyz", map[string]http.HandlerFunc{http.MethodGet: health.ReadyHandler})
+	handleMethods(mux, "/version", map[string]http.HandlerFunc{http.MethodGet: VersionHandler})
+	mux.HandleFunc("/", NotFoundHandler)
+	return LogRequests(logger, config.LogExpressions, mux)
 }
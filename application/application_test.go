@@ -1,13 +1,24 @@
 package application
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
 )
 
 func TestCalcHandlerBadRequestCase(t *testing.T) {
@@ -56,6 +67,42 @@ func TestCalcHandlerBadRequestCase(t *testing.T) {
 			expectedResult: map[string]string{"error": "undefined operand"},
 			wantBadRequest: http.StatusUnprocessableEntity,
 		},
+		{
+			name:           "invalid power",
+			data:           map[string]string{"expression": "0^(0-1)"},
+			expectedResult: map[string]string{"error": "invalid operands for exponentiation"},
+			wantBadRequest: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "modulo by zero",
+			data:           map[string]string{"expression": "3%0"},
+			expectedResult: map[string]string{"error": "modulo by zero"},
+			wantBadRequest: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "unknown function",
+			data:           map[string]string{"expression": "foo(2)"},
+			expectedResult: map[string]string{"error": "unknown function"},
+			wantBadRequest: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "too many arguments",
+			data:           map[string]string{"expression": "sqrt(2, 3)"},
+			expectedResult: map[string]string{"error": "too many arguments for function"},
+			wantBadRequest: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "overflow",
+			data:           map[string]string{"expression": "10^400"},
+			expectedResult: map[string]string{"error": "result is out of range"},
+			wantBadRequest: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "too many steps",
+			data:           map[string]string{"expression": "f(n) = n <= 0 ? 1 : f(n-1) + f(n-1); f(60)"},
+			expectedResult: map[string]string{"error": "evaluation takes too many steps"},
+			wantBadRequest: http.StatusUnprocessableEntity,
+		},
 	}
 	for _, testCase := range testCasesBad {
 		jsonValue, _ := json.Marshal(testCase.data)
@@ -212,3 +259,743 @@ func TestCalcHandlerSuccessCase(t *testing.T) {
 		}
 	}
 }
+
+func TestCalcHandlerErrorPosition(t *testing.T) {
+	jsonValue, _ := json.Marshal(map[string]string{"expression": "2+*3"})
+	req := httptest.NewRequest(http.MethodPost, "localhost:8080/api/v1/calculate", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	CalcHandler(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("handler returned wrong status code: got %v want %v", res.StatusCode, http.StatusUnprocessableEntity)
+	}
+	var answer AnswerBad
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("panic while unmarshal answer: %v", w.Body.String())
+	}
+	if answer.Position == nil || *answer.Position != 2 || answer.Token != "*" || len(answer.Expected) == 0 {
+		t.Fatalf("handler returned wrong error details: %v", w.Body.String())
+	}
+}
+
+func TestHandlerStatuses(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxBodySize = 64
+	handler := newHandler(config, NewExpressions(NewMemoryStore(), 1, DefaultQueueSize), NewLogger(io.Discard, config), NewMetrics(), NewHealth(calculate))
+	testCases := []struct {
+		name           string
+		method         string
+		url            string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedAllow  string
+		expectedBody   string
+	}{
+		{
+			name:           "result",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate",
+			contentType:    "application/json; charset=utf-8",
+			body:           `{"expression":"2+2"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":4}`,
+		},
+		{
+			name:           "no content type",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate",
+			body:           `{"expression":"2+2"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":4}`,
+		},
+		{
+			name:           "empty body",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate",
+			contentType:    "application/json",
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid json request"}`,
+		},
+		{
+			name:           "malformed json",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate",
+			contentType:    "application/json",
+			body:           `{"expression":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid json request"}`,
+		},
+		{
+			name:           "get",
+			method:         http.MethodGet,
+			url:            "/api/v1/calculate",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "POST",
+			expectedBody:   `{"error":"method not allowed"}`,
+		},
+		{
+			name:           "post to get endpoint",
+			method:         http.MethodPost,
+			url:            "/api/v1/functions",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, HEAD",
+			expectedBody:   `{"error":"method not allowed"}`,
+		},
+		{
+			name:           "delete expressions",
+			method:         http.MethodDelete,
+			url:            "/api/v1/expressions",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedAllow:  "GET, HEAD, POST",
+			expectedBody:   `{"error":"method not allowed"}`,
+		},
+		{
+			name:           "form",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate",
+			contentType:    "application/x-www-form-urlencoded",
+			body:           `expression=2+2`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedBody:   `{"error":"unsupported content type, expected application/json"}`,
+		},
+		{
+			name:           "text batch",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate/batch",
+			contentType:    "text/plain",
+			body:           `[]`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedBody:   `{"error":"unsupported content type, expected application/json"}`,
+		},
+		{
+			name:           "text stream",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate/stream",
+			contentType:    "text/plain",
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedBody:   `{"error":"unsupported content type, expected application/json"}`,
+		},
+		{
+			name:           "large body",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate",
+			body:           `{"expression":"1","variables":{"x":1,"y":2,"z":3,"t":4,"u":5,"v":6}}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   `{"error":"request body is too large"}`,
+		},
+		{
+			name:           "large expression body",
+			method:         http.MethodPost,
+			url:            "/api/v1/expressions",
+			body:           `{"expression":"` + strings.Repeat("1+", 30) + `1"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   `{"error":"request body is too large"}`,
+		},
+		{
+			name:           "unknown path",
+			method:         http.MethodGet,
+			url:            "/api/v2/calculate",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"not found"}`,
+		},
+		{
+			name:           "expression error",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate",
+			body:           `{"expression":"1/0"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"division by zero","position":1,"token":"/"}`,
+		},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(testCase.method, testCase.url, bytes.NewBufferString(testCase.body))
+		if testCase.contentType != "" {
+			req.Header.Set("Content-Type", testCase.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != testCase.expectedStatus {
+			t.Fatalf("Test: %s\nhandler returned wrong status code: got %v want %v", testCase.name, w.Code, testCase.expectedStatus)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Fatalf("Test: %s\nhandler returned content type %q", testCase.name, contentType)
+		}
+		if allow := w.Header().Get("Allow"); allow != testCase.expectedAllow {
+			t.Fatalf("Test: %s\nhandler returned Allow %q want %q", testCase.name, allow, testCase.expectedAllow)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != testCase.expectedBody {
+			t.Fatalf("Test: %s\nhandler returned wrong answer: got %s want %s", testCase.name, body, testCase.expectedBody)
+		}
+	}
+}
+
+func TestCalcHandlerMethod(t *testing.T) {
+	w := httptest.NewRecorder()
+	CalcHandler(w, httptest.NewRequest(http.MethodGet, "localhost:8080/api/v1/calculate", nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("GET answered with %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestFunctionsHandler(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "localhost:8080/api/v1/functions", nil)
+	w := httptest.NewRecorder()
+	FunctionsHandler(w, req)
+	res := w.Result()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", res.StatusCode, http.StatusOK)
+	}
+	var answer AnswerFunctions
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Fatalf("panic while unmarshal answer: %v", w.Body.String())
+	}
+	found := false
+	for _, function := range answer.Functions {
+		if function.Name == "max" {
+			found = function.MinArgs == 1 && function.MaxArgs == -1
+		}
+	}
+	if !found {
+		t.Fatalf("handler returned no variadic max function: %v", w.Body.String())
+	}
+}
+
+func TestCalcHandlerVariables(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "bound",
+			body:           `{"expression":"x*2+y","variables":{"x":3,"y":1}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":7}`,
+		},
+		{
+			name:           "unbound",
+			body:           `{"expression":"x*2+y","variables":{"x":3}}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"unbound identifier: y","position":4,"token":"y"}`,
+		},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "localhost:8080/api/v1/calculate", bytes.NewBufferString(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		CalcHandler(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		if res.StatusCode != testCase.expectedStatus {
+			t.Fatalf("Test: %s\nhandler returned wrong status code: got %v want %v", testCase.name, res.StatusCode, testCase.expectedStatus)
+		}
+		if body := bytes.TrimSpace(w.Body.Bytes()); string(body) != testCase.expectedBody {
+			t.Fatalf("Test: %s\nhandler returned wrong answer: got %s want %s", testCase.name, body, testCase.expectedBody)
+		}
+	}
+}
+
+func TestCalcHandlerModes(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "float",
+			body:           `{"expression":"((22.2/2)*3)*(-7)"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":-233.09999999999997}`,
+		},
+		{
+			name:           "decimal",
+			body:           `{"expression":"((22.2/2)*3)*(-7)","mode":"decimal"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":"-233.1"}`,
+		},
+		{
+			name:           "decimal precision",
+			body:           `{"expression":"2/3","mode":"decimal","precision":5}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":"0.66667"}`,
+		},
+		{
+			name:           "rational",
+			body:           `{"expression":"1/3+1/6","mode":"rational"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":"1/2","approximation":0.5}`,
+		},
+		{
+			name:           "rational out of float range",
+			body:           `{"expression":"-10^400","mode":"rational"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":"-1` + strings.Repeat("0", 400) + `"}`,
+		},
+		{
+			name:           "rational irrational function",
+			body:           `{"expression":"sin(1)/2","mode":"rational"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"result is not a rational number","position":0,"token":"sin"}`,
+		},
+		{
+			name:           "complex",
+			body:           `{"expression":"(3+4i)*(1-2i)","mode":"complex"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":{"re":11,"im":-2}}`,
+		},
+		{
+			name:           "complex division by zero",
+			body:           `{"expression":"1/(0i)","mode":"complex"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"division by zero","position":1,"token":"/"}`,
+		},
+		{
+			name:           "boolean as number",
+			body:           `{"expression":"x > 10 && y <= 3","variables":{"x":11,"y":3}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":1}`,
+		},
+		{
+			name:           "typed boolean",
+			body:           `{"expression":"x > 10 && y <= 3","variables":{"x":11,"y":3},"typed":true}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":true}`,
+		},
+		{
+			name:           "typed number",
+			body:           `{"expression":"x > 10 ? 1.5 : 1","variables":{"x":11},"typed":true}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":1.5}`,
+		},
+		{
+			name:           "integer",
+			body:           `{"expression":"0xFF & (1 << 4) | 3","mode":"integer"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":19}`,
+		},
+		{
+			name:           "integer hex",
+			body:           `{"expression":"~0","mode":"integer","unsigned":true,"format":"hex"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":"0xffffffffffffffff"}`,
+		},
+		{
+			name:           "integer bin",
+			body:           `{"expression":"5 << 1","mode":"integer","format":"bin"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":"0b1010"}`,
+		},
+		{
+			name:           "integer overflow",
+			body:           `{"expression":"2^63","mode":"integer"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"integer overflow","position":1,"token":"^"}`,
+		},
+		{
+			name:           "unknown format",
+			body:           `{"expression":"1","mode":"integer","format":"roman"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"unknown integer output format"}`,
+		},
+		{
+			name:           "user functions",
+			body:           `{"expression":"f(x) = x^2 + 1; g(a,b) = f(a) - b; g(3, 2)"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":8}`,
+		},
+		{
+			name:           "redefined built-in",
+			body:           `{"expression":"sin(x) = x; sin(1)"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"name is reserved: sin","position":0,"token":"sin"}`,
+		},
+		{
+			name:           "unknown mode",
+			body:           `{"expression":"1","mode":"octal"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"unknown evaluation mode"}`,
+		},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "localhost:8080/api/v1/calculate", bytes.NewBufferString(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		CalcHandler(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		if res.StatusCode != testCase.expectedStatus {
+			t.Fatalf("Test: %s\nhandler returned wrong status code: got %v want %v", testCase.name, res.StatusCode, testCase.expectedStatus)
+		}
+		if body := bytes.TrimSpace(w.Body.Bytes()); string(body) != testCase.expectedBody {
+			t.Fatalf("Test: %s\nhandler returned wrong answer: got %s want %s", testCase.name, body, testCase.expectedBody)
+		}
+	}
+}
+
+func TestProgramCache(t *testing.T) {
+	cache := NewProgramCache(2)
+	first, err := cache.Get("x+1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cache.Get("x+1"); again != first {
+		t.Fatalf("cached program was compiled again")
+	}
+	cache.Get("x+2")
+	cache.Get("x+1")
+	cache.Get("x+3")
+	if cache.Len() != 2 {
+		t.Fatalf("cache holds %d programs want 2", cache.Len())
+	}
+	if again, _ := cache.Get("x+1"); again != first {
+		t.Fatalf("recently used program was evicted")
+	}
+	if program, ok := cache.Peek("x+1"); !ok || program != first {
+		t.Fatalf("cached program was not found")
+	}
+	if _, ok := cache.Peek("x+2"); ok {
+		t.Fatalf("evicted program was found")
+	}
+	if _, err := cache.Get("x+"); err == nil {
+		t.Fatalf("invalid expression compiled")
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("failed compilation was cached")
+	}
+}
+
+func TestBatchHandler(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "mixed",
+			body:           `[{"expression":"2+2*2"},{"expression":"1/0"},{"expression":"x*2","variables":{"x":4}},{"expression":"2/3","mode":"rational"},{"expression":"255","mode":"integer","format":"hex"},{"expression":"1 < 2","typed":true},{"expression":"1","format":"roman"}]`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"index":0,"result":6},{"index":1,"error":"division by zero","position":1,"token":"/"},{"index":2,"result":8},{"index":3,"result":"2/3","approximation":0.6666666666666666},{"index":4,"result":"0xff"},{"index":5,"result":true},{"index":6,"error":"unknown integer output format"}]`,
+		},
+		{
+			name:           "empty",
+			body:           `[]`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[]`,
+		},
+		{
+			name:           "not an array",
+			body:           `{"expression":"2+2"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"invalid json request"}`,
+		},
+		{
+			name:           "too large",
+			body:           `[{"expression":"1"},{"expression":"2"},{"expression":"3"},{"expression":"4"},{"expression":"5"},{"expression":"6"},{"expression":"7"},{"expression":"8"}]`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   `{"error":"too many expressions in batch"}`,
+		},
+	}
+	handler := NewBatchHandler(calculate, 2, 7)
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, "localhost:8080/api/v1/calculate/batch", bytes.NewBufferString(testCase.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		if res.StatusCode != testCase.expectedStatus {
+			t.Fatalf("Test: %s\nhandler returned wrong status code: got %v want %v", testCase.name, res.StatusCode, testCase.expectedStatus)
+		}
+		if body := bytes.TrimSpace(w.Body.Bytes()); string(body) != testCase.expectedBody {
+			t.Fatalf("Test: %s\nhandler returned wrong answer: got %s want %s", testCase.name, body, testCase.expectedBody)
+		}
+	}
+}
+
+func TestCalculateBatchOrder(t *testing.T) {
+	requests := make([]Request, 100)
+	for i := range requests {
+		requests[i] = Request{Expression: "x + 1", Variables: map[string]float64{"x": float64(i)}}
+	}
+	for i, result := range calculateBatch(calculate, requests, 8) {
+		if result.Index != i || result.AnswerOk == nil || result.Result != float64(i+1) {
+			t.Fatalf("item %d answered with %+v", i, result)
+		}
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	body := "{\"expression\":\"2+2*2\"}\n\n{\"expression\":\"1/0\"}\nnot json\n{\"expression\":\"x\",\"variables\":{\"x\":5}}"
+	expectedBody := `{"index":0,"result":6}
+{"index":1,"error":"division by zero","position":1,"token":"/"}
+{"index":2,"error":"invalid json request"}
+{"index":3,"result":5}`
+	for _, order := range []string{"", "?order=input", "?order=completion"} {
+		req := httptest.NewRequest(http.MethodPost, "localhost:8080/api/v1/calculate/stream"+order, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		NewStreamHandler(calculate, 3)(w, req)
+		res := w.Result()
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("Test: %s\nhandler returned wrong status code: got %v want %v", order, res.StatusCode, http.StatusOK)
+		}
+		if contentType := res.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+			t.Fatalf("Test: %s\nhandler returned content type %s", order, contentType)
+		}
+		lines := strings.Split(string(bytes.TrimSpace(w.Body.Bytes())), "\n")
+		if order == "?order=completion" {
+			sort.Strings(lines)
+		}
+		if got := strings.Join(lines, "\n"); got != expectedBody {
+			t.Fatalf("Test: %s\nhandler returned wrong answer: got %s want %s", order, got, expectedBody)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "localhost:8080/api/v1/calculate/stream?order=random", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	NewStreamHandler(calculate, 3)(w, req)
+	if w.Code != http.StatusUnprocessableEntity || strings.TrimSpace(w.Body.String()) != `{"error":"unknown result order"}` {
+		t.Fatalf("unknown order answered with %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStreamHandlerDisconnect(t *testing.T) {
+	finished := make(chan struct{})
+	handler := NewStreamHandler(calculate, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r)
+		close(finished)
+	}))
+	defer server.Close()
+
+	body, input := io.Pipe()
+	defer input.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL, body)
+	go input.Write([]byte("{\"expression\":\"1+1\"}\n"))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if err != nil || line != "{\"index\":0,\"result\":2}\n" {
+		t.Fatalf("first result streamed as %q, %v", line, err)
+	}
+	cancel()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("handler did not stop after client disconnect")
+	}
+}
+
+// failingWriter fails every write and stops reads of body at its read
+// deadline, as the connection of a gone client does.
+type failingWriter struct {
+	*httptest.ResponseRecorder
+	body *io.PipeReader
+}
+
+func (w failingWriter) Write(data []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func (w failingWriter) SetReadDeadline(deadline time.Time) error {
+	if !deadline.IsZero() {
+		w.body.CloseWithError(os.ErrDeadlineExceeded)
+	}
+	return nil
+}
+
+// lateBody notes reads that end after the handler has returned.
+type lateBody struct {
+	io.Reader
+	returned atomic.Bool
+	late     atomic.Bool
+}
+
+func (b *lateBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if b.returned.Load() {
+		b.late.Store(true)
+	}
+	return n, err
+}
+
+func TestStreamHandlerFailedWrite(t *testing.T) {
+	body, input := io.Pipe()
+	defer input.Close()
+	tracked := &lateBody{Reader: body}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate/stream", tracked)
+	go input.Write([]byte("{\"expression\":\"1+1\"}\n"))
+	NewStreamHandler(calculate, 2)(failingWriter{httptest.NewRecorder(), body}, req)
+	tracked.returned.Store(true)
+	input.Close()
+	time.Sleep(50 * time.Millisecond)
+	if tracked.late.Load() {
+		t.Fatalf("body was read after the handler returned")
+	}
+}
+
+func TestExpressionsHandlers(t *testing.T) {
+	expressions := NewExpressions(NewMemoryStore(), 2, DefaultQueueSize)
+	mux := http.NewServeMux()
+	expressions.Register(mux, DefaultMaxBodySize)
+	do := func(method string, url string, body string) (int, string) {
+		req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+
+	status, body := do(http.MethodGet, "/api/v1/expressions", "")
+	if status != http.StatusOK || body != `{"expressions":[]}` {
+		t.Fatalf("empty list answered with %d %s", status, body)
+	}
+	creations := []struct {
+		body         string
+		expectedBody string
+	}{
+		{`{"expression":"2+2*2"}`, `{"id":"1"}`},
+		{`{"expression":"1/0"}`, `{"id":"2"}`},
+		{`{"expression":"2/4","mode":"rational"}`, `{"id":"3"}`},
+	}
+	for _, creation := range creations {
+		status, body := do(http.MethodPost, "/api/v1/expressions", creation.body)
+		if status != http.StatusCreated || body != creation.expectedBody {
+			t.Fatalf("%s created with %d %s", creation.body, status, body)
+		}
+	}
+	expressions.Wait()
+
+	testCases := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "done",
+			url:            "/api/v1/expressions/1",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"expression":{"id":"1","expression":"2+2*2","status":"done","result":6}}`,
+		},
+		{
+			name:           "error",
+			url:            "/api/v1/expressions/2",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"expression":{"id":"2","expression":"1/0","status":"error","error":"division by zero","position":1,"token":"/"}}`,
+		},
+		{
+			name:           "not found",
+			url:            "/api/v1/expressions/4",
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"expression not found"}`,
+		},
+		{
+			name:           "list",
+			url:            "/api/v1/expressions",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"expressions":[{"id":"1","expression":"2+2*2","status":"done","result":6},{"id":"2","expression":"1/0","status":"error","error":"division by zero","position":1,"token":"/"},{"id":"3","expression":"2/4","status":"done","result":"1/2","approximation":0.5}]}`,
+		},
+	}
+	for _, testCase := range testCases {
+		status, body := do(http.MethodGet, testCase.url, "")
+		if status != testCase.expectedStatus {
+			t.Fatalf("Test: %s\nhandler returned wrong status code: got %v want %v", testCase.name, status, testCase.expectedStatus)
+		}
+		if body != testCase.expectedBody {
+			t.Fatalf("Test: %s\nhandler returned wrong answer: got %s want %s", testCase.name, body, testCase.expectedBody)
+		}
+	}
+
+	status, body = do(http.MethodPost, "/api/v1/expressions", "{")
+	if status != http.StatusBadRequest || body != `{"error":"invalid json request"}` {
+		t.Fatalf("invalid json answered with %d %s", status, body)
+	}
+	status, body = do(http.MethodDelete, "/api/v1/expressions/1", "")
+	if status != http.StatusMethodNotAllowed || body != `{"error":"method not allowed"}` {
+		t.Fatalf("DELETE answered with %d %s", status, body)
+	}
+}
+
+func TestExpressionsQueue(t *testing.T) {
+	expressions := NewExpressions(NewMemoryStore(), 1, 1)
+	// The first expression occupies the only worker until it is released.
+	started, release := make(chan struct{}), make(chan struct{})
+	evaluate := expressions.Evaluate
+	expressions.Evaluate = func(request *Request) (calculator.Result, error) {
+		if request.Expression == "1" {
+			close(started)
+			<-release
+		}
+		return evaluate(request)
+	}
+	mux := http.NewServeMux()
+	expressions.Register(mux, 64)
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/expressions", bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := create(`{"expression":"1"}`); w.Code != http.StatusCreated {
+		t.Fatalf("first expression answered with %d %s", w.Code, w.Body.String())
+	}
+	<-started
+	if w := create(`{"expression":"1+1"}`); w.Code != http.StatusCreated {
+		t.Fatalf("queued expression answered with %d %s", w.Code, w.Body.String())
+	}
+	if expression, _ := expressions.store.Get("2"); expression.Status != StatusPending {
+		t.Fatalf("expression is %s before a worker is free", expression.Status)
+	}
+	w := create(`{"expression":"2+2"}`)
+	if w.Code != http.StatusServiceUnavailable || strings.TrimSpace(w.Body.String()) != `{"error":"too many expressions are waiting, retry later"}` || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expression over the queue answered with %d %s", w.Code, w.Body.String())
+	}
+	if _, err := expressions.store.Get("3"); err == nil {
+		t.Fatalf("rejected expression was saved")
+	}
+	if w := create(`{"expression":"` + strings.Repeat("1", 64) + `"}`); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large body answered with %d %s", w.Code, w.Body.String())
+	}
+
+	close(release)
+	expressions.Wait()
+	for _, id := range []string{"1", "2"} {
+		if expression, _ := expressions.store.Get(id); expression.Status != StatusDone {
+			t.Fatalf("expression %s is %s after it is computed", id, expression.Status)
+		}
+	}
+}
+
+func TestMemoryStoreLimit(t *testing.T) {
+	store := NewMemoryStore()
+	pending, _ := store.Create(Request{Expression: "1"})
+	for i := 1; i < MaxStoredExpressions; i++ {
+		expression, _ := store.Create(Request{Expression: "1"})
+		expression.Status = StatusDone
+		store.Update(expression)
+	}
+	last, _ := store.Create(Request{Expression: "2"})
+	if last.ID != strconv.Itoa(MaxStoredExpressions+1) {
+		t.Fatalf("expression got ID %s", last.ID)
+	}
+	expressions, _ := store.List()
+	if len(expressions) != MaxStoredExpressions {
+		t.Fatalf("store keeps %d expressions want %d", len(expressions), MaxStoredExpressions)
+	}
+	if _, err := store.Get(pending.ID); err != nil {
+		t.Fatalf("pending expression was forgotten")
+	}
+	if _, err := store.Get("2"); !errors.Is(err, ErrExpressionNotFound) {
+		t.Fatalf("oldest computed expression was kept")
+	}
+}
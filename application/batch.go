@@ -0,0 +1,89 @@
+package application
+
+import (
+	"errors"
+	"net/http"
+	"runtime"
+	"sync"
+)
+
+// DefaultMaxBatchSize is the largest number of expressions accepted in one
+// batch request.
+const DefaultMaxBatchSize = 1000
+
+// DefaultBatchWorkers is the number of expressions of a batch computed
+// concurrently.
+var DefaultBatchWorkers = runtime.NumCPU()
+
+var ErrBatchTooLarge = errors.New("too many expressions in batch")
+
+// BatchResult is the answer for the request at Index of a batch, with the
+// fields of either AnswerOk or AnswerBad.
+type BatchResult struct {
+	Index int `json:"index"`
+	*AnswerOk
+	*AnswerBad
+}
+
+// answerRequest computes the request at index of a batch. A panic of
+// evaluate is answered with ErrServer, as it would otherwise crash the
+// server from the goroutine of a worker.
+func answerRequest(evaluate Evaluator, index int, request *Request) (batch_result BatchResult) {
+	defer func() {
+		if recover() != nil {
+			bad := makeError(ErrServer)
+			batch_result = BatchResult{Index: index, AnswerBad: &bad}
+		}
+	}()
+	result, err := evaluate(request)
+	if err != nil {
+		answer := makeError(err)
+		return BatchResult{Index: index, AnswerBad: &answer}
+	}
+	answer := makeAnswer(result, request)
+	return BatchResult{Index: index, AnswerOk: &answer}
+}
+
+// calculateBatch computes requests on at most workers goroutines and
+// returns the answers in the order of requests.
+func calculateBatch(evaluate Evaluator, requests []Request, workers int) []BatchResult {
+	results := make([]BatchResult, len(requests))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(requests)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = answerRequest(evaluate, index, &requests[index])
+			}
+		}()
+	}
+	for index := range requests {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// NewBatchHandler returns a handler computing a JSON array of requests with
+// workers goroutines. Batches longer than max_size are rejected.
+func NewBatchHandler(evaluate Evaluator, workers int, max_size int) http.HandlerFunc {
+	if workers < 1 {
+		workers = 1
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var requests []Request
+		if err := decodeJSON(r, &requests); err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(requests) > max_size {
+			writeError(w, ErrBatchTooLarge)
+			return
+		}
+		writeJSON(w, http.StatusOK, calculateBatch(evaluate, requests, workers))
+	}
+}
@@ -0,0 +1,83 @@
+package application
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+// DefaultCacheSize is the number of compiled expressions CalcHandler keeps.
+const DefaultCacheSize = 1024
+
+// ProgramCache is a least recently used cache of compiled expressions.
+type ProgramCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type cacheEntry struct {
+	expression string
+	program    *calculator.Program
+}
+
+func NewProgramCache(capacity int) *ProgramCache {
+	return &ProgramCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the compiled expression, compiling and caching it on a miss.
+// Expressions that fail to compile are not cached.
+func (c *ProgramCache) Get(expression string) (*calculator.Program, error) {
+	c.mu.Lock()
+	if element, ok := c.items[expression]; ok {
+		c.order.MoveToFront(element)
+		c.mu.Unlock()
+		return element.Value.(*cacheEntry).program, nil
+	}
+	c.mu.Unlock()
+
+	program, err := calculator.Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[expression]; ok {
+		c.order.MoveToFront(element)
+		return element.Value.(*cacheEntry).program, nil
+	}
+	c.items[expression] = c.order.PushFront(&cacheEntry{expression: expression, program: program})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).expression)
+	}
+	return program, nil
+}
+
+// Peek returns the cached compiled expression without compiling it or
+// making it recently used.
+func (c *ProgramCache) Peek(expression string) (*calculator.Program, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[expression]
+	if !ok {
+		return nil, false
+	}
+	return element.Value.(*cacheEntry).program, true
+}
+
+func (c *ProgramCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+var programs = NewProgramCache(DefaultCacheSize)
@@ -0,0 +1,243 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultMaxBodySize         = 1 << 20
+	DefaultMaxExpressionLength = 10000
+)
+
+// Config is the configuration of the server. LoadConfig fills it from, in
+// increasing priority, the defaults, a YAML or JSON file, CALC_*
+// environment variables and command line flags.
+type Config struct {
+	// Mode is "server", "orchestrator" or "agent".
+	Mode         string
+	Address      string
+	GRPCAddress  string
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is how long in-flight requests are waited for
+	// when the server stops.
+	ShutdownTimeout time.Duration
+	// MaxBodySize is the largest request body in bytes.
+	MaxBodySize int64
+	// MaxExpressionLength is the longest expression in runes.
+	MaxExpressionLength int
+	// MaxBatchSize is the largest number of expressions in a batch.
+	MaxBatchSize int
+	// BatchWorkers is the number of expressions of a batch, a stream or
+	// the asynchronous API computed at once.
+	BatchWorkers int
+	// QueueSize is the number of asynchronous expressions waiting for a
+	// worker.
+	QueueSize int
+	LogLevel  slog.Level
+	// LogFormat is "text" or "json".
+	LogFormat string
+	// LogExpressions adds the expressions to the access log.
+	LogExpressions bool
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Mode:                "server",
+		Address:             ":8080",
+		GRPCAddress:         ":9090",
+		ReadTimeout:         10 * time.Second,
+		WriteTimeout:        30 * time.Second,
+		IdleTimeout:         2 * time.Minute,
+		ShutdownTimeout:     15 * time.Second,
+		MaxBodySize:         DefaultMaxBodySize,
+		MaxExpressionLength: DefaultMaxExpressionLength,
+		MaxBatchSize:        DefaultMaxBatchSize,
+		BatchWorkers:        DefaultBatchWorkers,
+		QueueSize:           DefaultQueueSize,
+		LogLevel:            slog.LevelInfo,
+		LogFormat:           "text",
+	}
+}
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+type option struct {
+	name  string
+	usage string
+}
+
+// options are named as flags; the file keys use "_" instead of "-", and
+// the environment variables are upper case with the CALC_ prefix.
+var options = []option{
+	{"mode", "server, orchestrator or agent"},
+	{"address", "address of the HTTP server"},
+	{"grpc-address", "address of the gRPC server, empty to disable it"},
+	{"read-timeout", "timeout of reading a request, 0 for none"},
+	{"write-timeout", "timeout of writing a response, 0 for none"},
+	{"idle-timeout", "timeout of an idle keep-alive connection, 0 for none"},
+	{"shutdown-timeout", "time given to in-flight requests on shutdown"},
+	{"max-body-size", "largest request body in bytes"},
+	{"max-expression-length", "longest expression in characters"},
+	{"max-batch-size", "largest number of expressions in a batch"},
+	{"batch-workers", "number of expressions computed at once"},
+	{"queue-size", "number of asynchronous expressions waiting for a worker"},
+	{"log-level", "debug, info, warn or error"},
+	{"log-format", "text or json"},
+	{"log-expressions", "log the expressions of requests"},
+}
+
+func envName(name string) string {
+	return "CALC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+func (c *Config) set(name string, value string) error {
+	var err error
+	switch name {
+	case "mode":
+		c.Mode = value
+	case "address":
+		c.Address = value
+	case "grpc-address":
+		c.GRPCAddress = value
+	case "read-timeout":
+		c.ReadTimeout, err = time.ParseDuration(value)
+	case "write-timeout":
+		c.WriteTimeout, err = time.ParseDuration(value)
+	case "idle-timeout":
+		c.IdleTimeout, err = time.ParseDuration(value)
+	case "shutdown-timeout":
+		c.ShutdownTimeout, err = time.ParseDuration(value)
+	case "max-body-size":
+		c.MaxBodySize, err = strconv.ParseInt(value, 10, 64)
+	case "max-expression-length":
+		c.MaxExpressionLength, err = strconv.Atoi(value)
+	case "max-batch-size":
+		c.MaxBatchSize, err = strconv.Atoi(value)
+	case "batch-workers":
+		c.BatchWorkers, err = strconv.Atoi(value)
+	case "queue-size":
+		c.QueueSize, err = strconv.Atoi(value)
+	case "log-level":
+		err = c.LogLevel.UnmarshalText([]byte(value))
+	case "log-format":
+		c.LogFormat = value
+	case "log-expressions":
+		c.LogExpressions, err = strconv.ParseBool(value)
+	default:
+		return fmt.Errorf("%w: unknown option %s", ErrInvalidConfig, name)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %q is not a valid value", ErrInvalidConfig, name, value)
+	}
+	return nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	values := map[string]interface{}{}
+	if filepath.Ext(path) == ".json" {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	for key, value := range values {
+		if err := c.set(strings.ReplaceAll(key, "_", "-"), fmt.Sprint(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadConfig reads the configuration from args, the environment and the
+// file given by the -config flag or CALC_CONFIG, and validates it.
+func LoadConfig(args []string) (Config, error) {
+	config := DefaultConfig()
+	flags := flag.NewFlagSet("calcserver", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("CALC_CONFIG"), "YAML or JSON configuration file")
+	for _, option := range options {
+		flags.String(option.name, "", option.usage+" (env "+envName(option.name)+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	if *path != "" {
+		if err := config.loadFile(*path); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, option := range options {
+		if value, ok := os.LookupEnv(envName(option.name)); ok {
+			if err := config.set(option.name, value); err != nil {
+				return Config{}, err
+			}
+		}
+	}
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		if err == nil && f.Name != "config" {
+			err = config.set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+func (c Config) Validate() error {
+	switch c.Mode {
+	case "server", "orchestrator", "agent":
+	default:
+		return fmt.Errorf("%w: unknown mode %q", ErrInvalidConfig, c.Mode)
+	}
+	if c.Address == "" {
+		return fmt.Errorf("%w: address is empty", ErrInvalidConfig)
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.ShutdownTimeout < 0 {
+		return fmt.Errorf("%w: timeouts must not be negative", ErrInvalidConfig)
+	}
+	if c.MaxBodySize <= 0 {
+		return fmt.Errorf("%w: max-body-size must be positive", ErrInvalidConfig)
+	}
+	if c.MaxExpressionLength <= 0 {
+		return fmt.Errorf("%w: max-expression-length must be positive", ErrInvalidConfig)
+	}
+	if c.MaxBatchSize <= 0 {
+		return fmt.Errorf("%w: max-batch-size must be positive", ErrInvalidConfig)
+	}
+	if c.BatchWorkers <= 0 {
+		return fmt.Errorf("%w: batch-workers must be positive", ErrInvalidConfig)
+	}
+	if c.QueueSize <= 0 {
+		return fmt.Errorf("%w: queue-size must be positive", ErrInvalidConfig)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return fmt.Errorf("%w: unknown log format %q", ErrInvalidConfig, c.LogFormat)
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package application
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(yamlPath, []byte("address: :8000\nread_timeout: 5s\nmax_body_size: 2048\nmax_batch_size: 50\n"), 0644)
+	jsonPath := filepath.Join(dir, "config.json")
+	os.WriteFile(jsonPath, []byte(`{"address": ":8001", "max_expression_length": 100, "grpc_address": ""}`), 0644)
+	badPath := filepath.Join(dir, "bad.yaml")
+	os.WriteFile(badPath, []byte("port: 80\n"), 0644)
+
+	defaults := DefaultConfig()
+	testCases := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		expected    func(config *Config)
+		expectedErr bool
+	}{
+		{
+			name:     "defaults",
+			expected: func(config *Config) {},
+		},
+		{
+			name: "yaml file",
+			args: []string{"-config", yamlPath},
+			expected: func(config *Config) {
+				config.Address = ":8000"
+				config.ReadTimeout = 5 * time.Second
+				config.MaxBodySize = 2048
+				config.MaxBatchSize = 50
+			},
+		},
+		{
+			name: "json file from environment",
+			env:  map[string]string{"CALC_CONFIG": jsonPath},
+			expected: func(config *Config) {
+				config.Address = ":8001"
+				config.MaxExpressionLength = 100
+				config.GRPCAddress = ""
+			},
+		},
+		{
+			name: "environment overrides file",
+			args: []string{"-config", yamlPath},
+			env:  map[string]string{"CALC_ADDRESS": ":9000", "CALC_IDLE_TIMEOUT": "0"},
+			expected: func(config *Config) {
+				config.Address = ":9000"
+				config.ReadTimeout = 5 * time.Second
+				config.IdleTimeout = 0
+				config.MaxBodySize = 2048
+				config.MaxBatchSize = 50
+			},
+		},
+		{
+			name: "flags override environment",
+			args: []string{"-address", ":9001", "-write-timeout", "1m", "-mode", "agent"},
+			env:  map[string]string{"CALC_ADDRESS": ":9000"},
+			expected: func(config *Config) {
+				config.Address = ":9001"
+				config.WriteTimeout = time.Minute
+				config.Mode = "agent"
+			},
+		},
+		{
+			name: "log options",
+			args: []string{"-log-level", "debug", "-log-format", "json", "-log-expressions", "true"},
+			expected: func(config *Config) {
+				config.LogLevel = slog.LevelDebug
+				config.LogFormat = "json"
+				config.LogExpressions = true
+			},
+		},
+		{
+			name:        "unknown log level",
+			env:         map[string]string{"CALC_LOG_LEVEL": "loud"},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown log format",
+			args:        []string{"-log-format", "xml"},
+			expectedErr: true,
+		},
+		{
+			name:        "invalid duration",
+			args:        []string{"-read-timeout", "soon"},
+			expectedErr: true,
+		},
+		{
+			name:        "negative timeout",
+			env:         map[string]string{"CALC_WRITE_TIMEOUT": "-1s"},
+			expectedErr: true,
+		},
+		{
+			name: "batch options",
+			args: []string{"-max-batch-size", "10", "-queue-size", "20"},
+			env:  map[string]string{"CALC_BATCH_WORKERS": "3"},
+			expected: func(config *Config) {
+				config.MaxBatchSize = 10
+				config.BatchWorkers = 3
+				config.QueueSize = 20
+			},
+		},
+		{
+			name:        "zero queue size",
+			args:        []string{"-queue-size", "0"},
+			expectedErr: true,
+		},
+		{
+			name:        "zero batch size",
+			env:         map[string]string{"CALC_MAX_BATCH_SIZE": "0"},
+			expectedErr: true,
+		},
+		{
+			name:        "negative batch workers",
+			args:        []string{"-batch-workers", "-1"},
+			expectedErr: true,
+		},
+		{
+			name:        "zero body size",
+			args:        []string{"-max-body-size", "0"},
+			expectedErr: true,
+		},
+		{
+			name:        "empty address",
+			args:        []string{"-address", ""},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown mode",
+			args:        []string{"-mode", "client"},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown flag",
+			args:        []string{"-port", "80"},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown file key",
+			args:        []string{"-config", badPath},
+			expectedErr: true,
+		},
+		{
+			name:        "missing file",
+			args:        []string{"-config", filepath.Join(dir, "missing.yaml")},
+			expectedErr: true,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			for name, value := range testCase.env {
+				t.Setenv(name, value)
+			}
+			config, err := LoadConfig(testCase.args)
+			if testCase.expectedErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Fatalf("got error %v want %v", err, ErrInvalidConfig)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := defaults
+			testCase.expected(&expected)
+			if config != expected {
+				t.Fatalf("got %+v want %+v", config, expected)
+			}
+		})
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxBodySize = 64
+	config.MaxExpressionLength = 5
+	config.MaxBatchSize = 2
+	config.BatchWorkers = 1
+	handler := NewHandler(config)
+	lines := make([]string, 10)
+	for i := range lines {
+		lines[i] = `{"index":` + strconv.Itoa(i) + `,"result":1}`
+	}
+	streamAnswer := strings.Join(lines, "\n")
+	testCases := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "short expression",
+			url:            "/api/v1/calculate",
+			body:           `{"expression":"2+2*2"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"result":6}`,
+		},
+		{
+			name:           "long expression",
+			url:            "/api/v1/calculate",
+			body:           `{"expression":"2+2*2+1"}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedBody:   `{"error":"expression is too long"}`,
+		},
+		{
+			name:           "long expression in batch",
+			url:            "/api/v1/calculate/batch",
+			body:           `[{"expression":"1"},{"expression":"123456"}]`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"index":0,"result":1},{"index":1,"error":"expression is too long"}]`,
+		},
+		{
+			name:           "large batch",
+			url:            "/api/v1/calculate/batch",
+			body:           `[{"expression":"1"},{"expression":"2"},{"expression":"3"}]`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   `{"error":"too many expressions in batch"}`,
+		},
+		{
+			name:           "large body",
+			url:            "/api/v1/calculate",
+			body:           `{"expression":"1","variables":{"x":1,"y":2,"z":3,"t":4,"u":5,"v":6}}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedBody:   `{"error":"request body is too large"}`,
+		},
+		{
+			name:           "stream is not limited by body size",
+			url:            "/api/v1/calculate/stream",
+			body:           strings.Repeat("{\"expression\":\"1\"}\n", 10),
+			expectedStatus: http.StatusOK,
+			expectedBody:   streamAnswer,
+		},
+	}
+	for _, testCase := range testCases {
+		req := httptest.NewRequest(http.MethodPost, testCase.url, bytes.NewBufferString(testCase.body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != testCase.expectedStatus {
+			t.Fatalf("Test: %s\nhandler returned wrong status code: got %v want %v", testCase.name, w.Code, testCase.expectedStatus)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != testCase.expectedBody {
+			t.Fatalf("Test: %s\nhandler returned wrong answer: got %s want %s", testCase.name, body, testCase.expectedBody)
+		}
+	}
+}
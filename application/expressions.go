@@ -0,0 +1,267 @@
+package application
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusError   Status = "error"
+)
+
+// DefaultQueueSize is the number of expressions the asynchronous API keeps
+// waiting for a worker; more are rejected with ErrQueueFull.
+const DefaultQueueSize = 1000
+
+// MaxStoredExpressions is the number of expressions kept by MemoryStore.
+// Once it is reached, the oldest computed expression is forgotten.
+const MaxStoredExpressions = 10000
+
+var (
+	ErrExpressionNotFound = errors.New("expression not found")
+	ErrQueueFull          = errors.New("too many expressions are waiting, retry later")
+)
+
+// Expression is a request computed in the background. Once it is done it
+// has the fields of AnswerOk, and of AnswerBad if it failed.
+type Expression struct {
+	ID         string  `json:"id"`
+	Expression string  `json:"expression"`
+	Status     Status  `json:"status"`
+	Request    Request `json:"-"`
+	*AnswerOk
+	*AnswerBad
+}
+
+type AnswerCreated struct {
+	ID string `json:"id"`
+}
+
+type AnswerExpression struct {
+	Expression Expression `json:"expression"`
+}
+
+type AnswerExpressions struct {
+	Expressions []Expression `json:"expressions"`
+}
+
+// ExpressionStore keeps expressions between the request that creates them
+// and the requests polling their status.
+type ExpressionStore interface {
+	// Create saves a pending expression for request and assigns its ID.
+	Create(request Request) (Expression, error)
+	Update(expression Expression) error
+	// Get returns ErrExpressionNotFound for unknown IDs.
+	Get(id string) (Expression, error)
+	// List returns expressions in the order they were created.
+	List() ([]Expression, error)
+}
+
+// MemoryStore is an ExpressionStore keeping expressions in memory.
+type MemoryStore struct {
+	mu          sync.Mutex
+	expressions map[string]Expression
+	ids         []string
+	next_id     int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{expressions: make(map[string]Expression)}
+}
+
+func (s *MemoryStore) Create(request Request) (Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.ids) >= MaxStoredExpressions {
+		s.forgetComputed()
+	}
+	s.next_id++
+	expression := Expression{
+		ID:         strconv.Itoa(s.next_id),
+		Expression: request.Expression,
+		Status:     StatusPending,
+		Request:    request,
+	}
+	s.expressions[expression.ID] = expression
+	s.ids = append(s.ids, expression.ID)
+	return expression, nil
+}
+
+// forgetComputed removes the oldest expression that is done or failed.
+// Pending and running ones are kept, there are at most as many of them as
+// the queue and the workers hold.
+func (s *MemoryStore) forgetComputed() {
+	for i, id := range s.ids {
+		if status := s.expressions[id].Status; status == StatusDone || status == StatusError {
+			delete(s.expressions, id)
+			s.ids = append(s.ids[:i], s.ids[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *MemoryStore) Update(expression Expression) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.expressions[expression.ID]; !ok {
+		return ErrExpressionNotFound
+	}
+	s.expressions[expression.ID] = expression
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expression, ok := s.expressions[id]
+	if !ok {
+		return Expression{}, ErrExpressionNotFound
+	}
+	return expression, nil
+}
+
+func (s *MemoryStore) List() ([]Expression, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expressions := make([]Expression, len(s.ids))
+	for i, id := range s.ids {
+		expressions[i] = s.expressions[id]
+	}
+	return expressions, nil
+}
+
+// Evaluator computes a request. Errors that are not caused by the
+// expression should be reported as ErrServer.
+type Evaluator func(request *Request) (calculator.Result, error)
+
+// Expressions serves the asynchronous API: expressions are saved to store
+// and computed in the background by workers goroutines. At most queue_size
+// expressions wait for a worker, the requests adding more are rejected.
+type Expressions struct {
+	// Evaluate computes the expressions, in this process unless replaced
+	// before the handlers are used.
+	Evaluate Evaluator
+	store    ExpressionStore
+	// slots holds a place for every expression in queue, so that a full
+	// queue is found before the expression is saved.
+	slots chan struct{}
+	queue chan Expression
+	wg    sync.WaitGroup
+}
+
+func NewExpressions(store ExpressionStore, workers int, queue_size int) *Expressions {
+	if workers < 1 {
+		workers = 1
+	}
+	if queue_size < 1 {
+		queue_size = 1
+	}
+	e := &Expressions{
+		Evaluate: NewEvaluator(DefaultMaxExpressionLength),
+		store:    store,
+		slots:    make(chan struct{}, queue_size),
+		queue:    make(chan Expression, queue_size),
+	}
+	for i := 0; i < workers; i++ {
+		go e.work()
+	}
+	return e
+}
+
+// Wait blocks until all created expressions are computed.
+func (e *Expressions) Wait() {
+	e.wg.Wait()
+}
+
+func (e *Expressions) work() {
+	for expression := range e.queue {
+		<-e.slots
+		e.run(expression)
+	}
+}
+
+func (e *Expressions) run(expression Expression) {
+	defer e.wg.Done()
+	expression.Status = StatusRunning
+	if e.store.Update(expression) != nil {
+		return
+	}
+	result, err := e.Evaluate(&expression.Request)
+	if err != nil {
+		answer := makeError(err)
+		expression.Status, expression.AnswerBad = StatusError, &answer
+	} else {
+		answer := makeAnswer(result, &expression.Request)
+		expression.Status, expression.AnswerOk = StatusDone, &answer
+	}
+	e.store.Update(expression)
+}
+
+func (e *Expressions) CreateHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	request := new(Request)
+	if err := decodeJSON(r, request); err != nil {
+		noteError(r, err)
+		writeError(w, err)
+		return
+	}
+	noteRequest(r, request.Expression, calculator.Result{}, nil)
+	select {
+	case e.slots <- struct{}{}:
+	default:
+		noteError(r, ErrQueueFull)
+		w.Header().Set("Retry-After", "1")
+		writeError(w, ErrQueueFull)
+		return
+	}
+	expression, err := e.store.Create(*request)
+	if err != nil {
+		<-e.slots
+		writeError(w, ErrServer)
+		return
+	}
+	e.wg.Add(1)
+	e.queue <- expression
+	writeJSON(w, http.StatusCreated, AnswerCreated{ID: expression.ID})
+}
+
+func (e *Expressions) GetHandler(w http.ResponseWriter, r *http.Request) {
+	expression, err := e.store.Get(r.PathValue("id"))
+	if errors.Is(err, ErrExpressionNotFound) {
+		writeError(w, err)
+		return
+	}
+	if err != nil {
+		writeError(w, ErrServer)
+		return
+	}
+	writeJSON(w, http.StatusOK, AnswerExpression{Expression: expression})
+}
+
+func (e *Expressions) ListHandler(w http.ResponseWriter, r *http.Request) {
+	expressions, err := e.store.List()
+	if err != nil {
+		writeError(w, ErrServer)
+		return
+	}
+	writeJSON(w, http.StatusOK, AnswerExpressions{Expressions: expressions})
+}
+
+// Register adds the asynchronous API to mux, limiting the bodies of the
+// requests to max_body_size bytes.
+func (e *Expressions) Register(mux *http.ServeMux, max_body_size int64) {
+	handleMethods(mux, "/api/v1/expressions", map[string]http.HandlerFunc{
+		http.MethodPost: limitBody(max_body_size, e.CreateHandler),
+		http.MethodGet:  e.ListHandler,
+	})
+	handleMethods(mux, "/api/v1/expressions/{id}", map[string]http.HandlerFunc{http.MethodGet: e.GetHandler})
+}
@@ -0,0 +1,158 @@
+package application
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Varman56/CalcServer.git/api/calculatorpb"
+)
+
+// CalculatorService implements the gRPC Calculator service on top of the
+// same evaluation as CalcHandler.
+type CalculatorService struct {
+	calculatorpb.UnimplementedCalculatorServer
+	evaluate Evaluator
+	workers  int
+	max_size int
+}
+
+func NewCalculatorService(evaluate Evaluator, workers int, max_size int) *CalculatorService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &CalculatorService{evaluate: evaluate, workers: workers, max_size: max_size}
+}
+
+func fromProto(request *calculatorpb.CalculateRequest) Request {
+	return Request{
+		Expression: request.GetExpression(),
+		Variables:  request.GetVariables(),
+		Mode:       request.GetMode(),
+		Precision:  uint(request.GetPrecision()),
+		Typed:      request.GetTyped(),
+		Unsigned:   request.GetUnsigned(),
+		Format:     request.GetFormat(),
+	}
+}
+
+func errorToProto(answer *AnswerBad) *calculatorpb.Error {
+	res := &calculatorpb.Error{Message: answer.Error, Token: answer.Token, Expected: answer.Expected}
+	if answer.Position != nil {
+		position := int32(*answer.Position)
+		res.Position = &position
+	}
+	return res
+}
+
+func toProto(result BatchResult) *calculatorpb.CalculateResponse {
+	res := &calculatorpb.CalculateResponse{Index: int32(result.Index)}
+	if result.AnswerBad != nil {
+		res.Result = &calculatorpb.CalculateResponse_Error{Error: errorToProto(result.AnswerBad)}
+		return res
+	}
+	switch value := result.Result.(type) {
+	case float64:
+		res.Result = &calculatorpb.CalculateResponse_Number{Number: value}
+	case bool:
+		res.Result = &calculatorpb.CalculateResponse_Boolean{Boolean: value}
+	case string:
+		res.Result = &calculatorpb.CalculateResponse_Text{Text: value}
+	case json.Number:
+		res.Result = &calculatorpb.CalculateResponse_Text{Text: string(value)}
+	case ComplexResult:
+		res.Result = &calculatorpb.CalculateResponse_Complex{Complex: &calculatorpb.Complex{Re: value.Re, Im: value.Im}}
+	}
+	res.Approximation = result.Approximation
+	return res
+}
+
+func (s *CalculatorService) Calculate(ctx context.Context, request *calculatorpb.CalculateRequest) (*calculatorpb.CalculateResponse, error) {
+	req := fromProto(request)
+	result, err := s.evaluate(&req)
+	if err != nil {
+		code := codes.InvalidArgument
+		if httpStatus(err) == http.StatusInternalServerError {
+			code = codes.Internal
+		}
+		answer := makeError(err)
+		st, detailsErr := status.New(code, answer.Error).WithDetails(errorToProto(&answer))
+		if detailsErr != nil {
+			return nil, status.Error(code, answer.Error)
+		}
+		return nil, st.Err()
+	}
+	answer := makeAnswer(result, &req)
+	return toProto(BatchResult{AnswerOk: &answer}), nil
+}
+
+func (s *CalculatorService) CalculateBatch(ctx context.Context, request *calculatorpb.CalculateBatchRequest) (*calculatorpb.CalculateBatchResponse, error) {
+	if len(request.GetRequests()) > s.max_size {
+		return nil, status.Error(codes.InvalidArgument, ErrBatchTooLarge.Error())
+	}
+	requests := make([]Request, len(request.GetRequests()))
+	for i, req := range request.GetRequests() {
+		requests[i] = fromProto(req)
+	}
+	res := &calculatorpb.CalculateBatchResponse{}
+	for _, result := range calculateBatch(s.evaluate, requests, s.workers) {
+		res.Results = append(res.Results, toProto(result))
+	}
+	return res, nil
+}
+
+func (s *CalculatorService) CalculateStream(stream calculatorpb.Calculator_CalculateStreamServer) error {
+	for index := 0; ; index++ {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		req := fromProto(request)
+		if err := stream.Send(toProto(answerRequest(s.evaluate, index, &req))); err != nil {
+			return err
+		}
+	}
+}
+
+var errPanic = status.Error(codes.Internal, ErrServer.Error())
+
+// recoverUnary answers a panic of a call with codes.Internal, so that it
+// does not crash the server as net/http would not either.
+func recoverUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res any, err error) {
+	defer func() {
+		if recover() != nil {
+			res, err = nil, errPanic
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func recoverStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = errPanic
+		}
+	}()
+	return handler(srv, stream)
+}
+
+// NewGRPCServer returns a gRPC server with the Calculator service limited
+// by config.
+func NewGRPCServer(config Config) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(int(config.MaxBodySize)),
+		grpc.UnaryInterceptor(recoverUnary),
+		grpc.StreamInterceptor(recoverStream),
+	)
+	service := NewCalculatorService(NewEvaluator(config.MaxExpressionLength), config.BatchWorkers, config.MaxBatchSize)
+	calculatorpb.RegisterCalculatorServer(server, service)
+	return server
+}
@@ -0,0 +1,200 @@
+package application
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Varman56/CalcServer.git/api/calculatorpb"
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+func newCalculatorClient(t *testing.T, service *CalculatorService) calculatorpb.CalculatorClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(recoverUnary), grpc.StreamInterceptor(recoverStream))
+	calculatorpb.RegisterCalculatorServer(server, service)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return calculatorpb.NewCalculatorClient(conn)
+}
+
+func compactText(message proto.Message) string {
+	return prototext.MarshalOptions{}.Format(message)
+}
+
+func TestGRPCCalculate(t *testing.T) {
+	client := newCalculatorClient(t, NewCalculatorService(NewEvaluator(DefaultMaxExpressionLength), 2, 3))
+	testCases := []struct {
+		name         string
+		request      *calculatorpb.CalculateRequest
+		expected     *calculatorpb.CalculateResponse
+		expectedCode codes.Code
+		expectedErr  *calculatorpb.Error
+	}{
+		{
+			name:     "float",
+			request:  &calculatorpb.CalculateRequest{Expression: "x*2+1", Variables: map[string]float64{"x": 3}},
+			expected: &calculatorpb.CalculateResponse{Result: &calculatorpb.CalculateResponse_Number{Number: 7}},
+		},
+		{
+			name:     "rational",
+			request:  &calculatorpb.CalculateRequest{Expression: "1/2", Mode: "rational"},
+			expected: &calculatorpb.CalculateResponse{Result: &calculatorpb.CalculateResponse_Text{Text: "1/2"}, Approximation: proto.Float64(0.5)},
+		},
+		{
+			name:     "complex",
+			request:  &calculatorpb.CalculateRequest{Expression: "sqrt(-4)", Mode: "complex"},
+			expected: &calculatorpb.CalculateResponse{Result: &calculatorpb.CalculateResponse_Complex{Complex: &calculatorpb.Complex{Re: 0, Im: 2}}},
+		},
+		{
+			name:     "integer",
+			request:  &calculatorpb.CalculateRequest{Expression: "2^40", Mode: "integer"},
+			expected: &calculatorpb.CalculateResponse{Result: &calculatorpb.CalculateResponse_Text{Text: "1099511627776"}},
+		},
+		{
+			name:     "typed",
+			request:  &calculatorpb.CalculateRequest{Expression: "1 < 2", Typed: true},
+			expected: &calculatorpb.CalculateResponse{Result: &calculatorpb.CalculateResponse_Boolean{Boolean: true}},
+		},
+		{
+			name:         "division by zero",
+			request:      &calculatorpb.CalculateRequest{Expression: "1/0"},
+			expectedCode: codes.InvalidArgument,
+			expectedErr:  &calculatorpb.Error{Message: "division by zero", Position: proto.Int32(1), Token: "/"},
+		},
+		{
+			name:         "infinite variable in rational mode",
+			request:      &calculatorpb.CalculateRequest{Expression: "x+1", Mode: "rational", Variables: map[string]float64{"x": math.Inf(1)}},
+			expectedCode: codes.InvalidArgument,
+			expectedErr:  &calculatorpb.Error{Message: "failure to convert to float64", Position: proto.Int32(0), Token: "x"},
+		},
+		{
+			name:         "unknown format",
+			request:      &calculatorpb.CalculateRequest{Expression: "1", Format: "roman"},
+			expectedCode: codes.InvalidArgument,
+			expectedErr:  &calculatorpb.Error{Message: "unknown integer output format"},
+		},
+	}
+	for _, testCase := range testCases {
+		res, err := client.Calculate(context.Background(), testCase.request)
+		if testCase.expectedErr != nil {
+			st := status.Convert(err)
+			if st.Code() != testCase.expectedCode || len(st.Details()) != 1 {
+				t.Fatalf("Test: %s\ngot status %v want %v with details", testCase.name, st, testCase.expectedCode)
+			}
+			if details, _ := st.Details()[0].(*calculatorpb.Error); !proto.Equal(details, testCase.expectedErr) {
+				t.Fatalf("Test: %s\ngot error %v want %v", testCase.name, st.Details()[0], compactText(testCase.expectedErr))
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Test: %s\nreturned error %v", testCase.name, err)
+		}
+		if !proto.Equal(res, testCase.expected) {
+			t.Fatalf("Test: %s\ngot %s want %s", testCase.name, compactText(res), compactText(testCase.expected))
+		}
+	}
+}
+
+func TestGRPCPanic(t *testing.T) {
+	evaluate := func(request *Request) (calculator.Result, error) {
+		panic("evaluator bug")
+	}
+	client := newCalculatorClient(t, NewCalculatorService(evaluate, 2, 3))
+	_, err := client.Calculate(context.Background(), &calculatorpb.CalculateRequest{Expression: "1"})
+	if st := status.Convert(err); st.Code() != codes.Internal || st.Message() != ErrServer.Error() {
+		t.Fatalf("panic answered with %v", st)
+	}
+	res, err := client.CalculateBatch(context.Background(), &calculatorpb.CalculateBatchRequest{
+		Requests: []*calculatorpb.CalculateRequest{{Expression: "1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &calculatorpb.CalculateBatchResponse{Results: []*calculatorpb.CalculateResponse{
+		{Index: 0, Result: &calculatorpb.CalculateResponse_Error{Error: &calculatorpb.Error{Message: ErrServer.Error()}}},
+	}}
+	if !proto.Equal(res, expected) {
+		t.Fatalf("got %s want %s", compactText(res), compactText(expected))
+	}
+	if _, err := client.Calculate(context.Background(), &calculatorpb.CalculateRequest{Expression: "1"}); status.Code(err) != codes.Internal {
+		t.Fatalf("server did not survive the panic: %v", err)
+	}
+}
+
+func TestGRPCCalculateBatch(t *testing.T) {
+	client := newCalculatorClient(t, NewCalculatorService(NewEvaluator(DefaultMaxExpressionLength), 2, 3))
+	res, err := client.CalculateBatch(context.Background(), &calculatorpb.CalculateBatchRequest{
+		Requests: []*calculatorpb.CalculateRequest{{Expression: "2+2*2"}, {Expression: "1/0"}, {Expression: "255", Mode: "integer", Format: "hex"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &calculatorpb.CalculateBatchResponse{Results: []*calculatorpb.CalculateResponse{
+		{Index: 0, Result: &calculatorpb.CalculateResponse_Number{Number: 6}},
+		{Index: 1, Result: &calculatorpb.CalculateResponse_Error{Error: &calculatorpb.Error{Message: "division by zero", Position: proto.Int32(1), Token: "/"}}},
+		{Index: 2, Result: &calculatorpb.CalculateResponse_Text{Text: "0xff"}},
+	}}
+	if !proto.Equal(res, expected) {
+		t.Fatalf("got %s want %s", compactText(res), compactText(expected))
+	}
+
+	requests := make([]*calculatorpb.CalculateRequest, 4)
+	for i := range requests {
+		requests[i] = &calculatorpb.CalculateRequest{Expression: "1"}
+	}
+	_, err = client.CalculateBatch(context.Background(), &calculatorpb.CalculateBatchRequest{Requests: requests})
+	if st := status.Convert(err); st.Code() != codes.InvalidArgument || st.Message() != ErrBatchTooLarge.Error() {
+		t.Fatalf("too large batch answered with %v", st)
+	}
+}
+
+func TestGRPCCalculateStream(t *testing.T) {
+	client := newCalculatorClient(t, NewCalculatorService(NewEvaluator(DefaultMaxExpressionLength), 2, 3))
+	stream, err := client.CalculateStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expressions := []string{"1+1", "2x", "3*3"}
+	expected := []*calculatorpb.CalculateResponse{
+		{Index: 0, Result: &calculatorpb.CalculateResponse_Number{Number: 2}},
+		{Index: 1, Result: &calculatorpb.CalculateResponse_Error{Error: &calculatorpb.Error{Message: "unbound identifier: x", Position: proto.Int32(1), Token: "x"}}},
+		{Index: 2, Result: &calculatorpb.CalculateResponse_Number{Number: 9}},
+	}
+	for i, expression := range expressions {
+		if err := stream.Send(&calculatorpb.CalculateRequest{Expression: expression}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(res, expected[i]) {
+			t.Fatalf("got %s want %s", compactText(res), compactText(expected[i]))
+		}
+	}
+	stream.CloseSend()
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Fatalf("stream ended with %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package application
+
+import (
+	"errors"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// The readiness probe computes selfTestExpression and compares it with
+// selfTestResult.
+const (
+	selfTestExpression = "max(2+2*2, sqrt(16)) // 1"
+	selfTestResult     = 6
+)
+
+var (
+	ErrShuttingDown   = errors.New("server is shutting down")
+	ErrSelfTestFailed = errors.New("self-test expression failed")
+)
+
+type AnswerStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type AnswerVersion struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Health answers the liveness and readiness probes. The server is ready
+// until Stop is called, as long as it computes the self-test expression.
+type Health struct {
+	evaluate Evaluator
+	stopping atomic.Bool
+}
+
+func NewHealth(evaluate Evaluator) *Health {
+	return &Health{evaluate: evaluate}
+}
+
+// Stop makes the server not ready, so that no new requests are sent to it.
+func (h *Health) Stop() {
+	h.stopping.Store(true)
+}
+
+func (h *Health) check() error {
+	if h.stopping.Load() {
+		return ErrShuttingDown
+	}
+	result, err := h.evaluate(&Request{Expression: selfTestExpression})
+	if err != nil || result.Float != selfTestResult {
+		return ErrSelfTestFailed
+	}
+	return nil
+}
+
+// HealthHandler answers while the process serves HTTP requests at all.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, AnswerStatus{Status: "ok"})
+}
+
+func (h *Health) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.check(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, AnswerStatus{Status: "not ready", Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, AnswerStatus{Status: "ready"})
+}
+
+// buildVersion returns the version of the binary from its build info.
+func buildVersion() AnswerVersion {
+	answer := AnswerVersion{Version: "unknown", GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return answer
+	}
+	if info.Main.Version != "" {
+		answer.Version = info.Main.Version
+	}
+	if info.GoVersion != "" {
+		answer.GoVersion = info.GoVersion
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			answer.Revision = setting.Value
+		case "vcs.time":
+			answer.Time = setting.Value
+		case "vcs.modified":
+			answer.Modified = setting.Value == "true"
+		}
+	}
+	return answer
+}
+
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, buildVersion())
+}
@@ -0,0 +1,104 @@
+package application
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	config := DefaultConfig()
+	broken := func(request *Request) (calculator.Result, error) {
+		return calculator.Result{}, ErrServer
+	}
+	wrong := func(request *Request) (calculator.Result, error) {
+		return calculator.Result{Float: 5}, nil
+	}
+	stopped := NewHealth(NewEvaluator(config.MaxExpressionLength))
+	stopped.Stop()
+	testCases := []struct {
+		name           string
+		health         *Health
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "alive",
+			health:         NewHealth(NewEvaluator(config.MaxExpressionLength)),
+			url:            "/healthz",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			name:           "ready",
+			health:         NewHealth(NewEvaluator(config.MaxExpressionLength)),
+			url:            "/readyz",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ready"}`,
+		},
+		{
+			name:           "shutting down",
+			health:         stopped,
+			url:            "/readyz",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"not ready","error":"server is shutting down"}`,
+		},
+		{
+			name:           "alive while shutting down",
+			health:         stopped,
+			url:            "/healthz",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ok"}`,
+		},
+		{
+			name:           "self-test error",
+			health:         NewHealth(broken),
+			url:            "/readyz",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"not ready","error":"self-test expression failed"}`,
+		},
+		{
+			name:           "wrong self-test result",
+			health:         NewHealth(wrong),
+			url:            "/readyz",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"not ready","error":"self-test expression failed"}`,
+		},
+	}
+	for _, testCase := range testCases {
+		handler := newHandler(config, NewExpressions(NewMemoryStore(), 1, DefaultQueueSize), NewLogger(io.Discard, config), NewMetrics(), testCase.health)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, testCase.url, nil))
+		if w.Code != testCase.expectedStatus {
+			t.Fatalf("Test: %s\nhandler returned wrong status code: got %v want %v", testCase.name, w.Code, testCase.expectedStatus)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != testCase.expectedBody {
+			t.Fatalf("Test: %s\nhandler returned unexpected body: got %v want %v", testCase.name, body, testCase.expectedBody)
+		}
+		if w.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("Test: %s\nhandler returned content type %q", testCase.name, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewHandler(DefaultConfig()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("version answered with %d", w.Code)
+	}
+	var answer AnswerVersion
+	if err := json.Unmarshal(w.Body.Bytes(), &answer); err != nil {
+		t.Fatal(err)
+	}
+	if answer.Version == "" || answer.GoVersion != runtime.Version() {
+		t.Fatalf("version answered as %+v", answer)
+	}
+}
@@ -0,0 +1,189 @@
+package application
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+// RequestIDHeader carries the ID of a request. An ID sent by the client is
+// kept, otherwise a random one is generated; either way it is returned in
+// the response.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+// maxLoggedResult is the longest result written to the access log, as
+// exact results may have millions of digits.
+const maxLoggedResult = 100
+
+// NewLogger returns a logger writing to w in the format and from the level
+// of config.
+func NewLogger(w io.Writer, config Config) *slog.Logger {
+	options := &slog.HandlerOptions{Level: config.LogLevel}
+	if config.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// errorKinds are the errors the requests are told apart by, in addition
+// to ErrServer.
+var errorKinds = append([]error{ErrInvalidInput, ErrUnsupportedMediaType, ErrBodyTooLarge, ErrUnknownFormat, ErrExpressionTooLong, ErrBatchTooLarge, ErrExpressionNotFound, ErrQueueFull}, errorsToCheck...)
+
+// errorKind returns the message of the sentinel err wraps, so that errors
+// of the same kind are logged and counted together whatever their position.
+func errorKind(err error) string {
+	for _, sentinel := range errorKinds {
+		if errors.Is(err, sentinel) {
+			return sentinel.Error()
+		}
+	}
+	return ErrServer.Error()
+}
+
+// logEntry is what the handlers tell the access log about a request.
+type logEntry struct {
+	expression string
+	noted      bool
+	mode       calculator.Mode
+	result     string
+	err        error
+}
+
+type logEntryKey struct{}
+
+// withLogEntry returns r with an access log entry, reusing the entry r
+// already has.
+func withLogEntry(r *http.Request) (*http.Request, *logEntry) {
+	if entry, ok := r.Context().Value(logEntryKey{}).(*logEntry); ok {
+		return r, entry
+	}
+	entry := &logEntry{}
+	return r.WithContext(context.WithValue(r.Context(), logEntryKey{}, entry)), entry
+}
+
+func requestLogEntry(r *http.Request) *logEntry {
+	entry, _ := r.Context().Value(logEntryKey{}).(*logEntry)
+	if entry == nil {
+		return &logEntry{}
+	}
+	return entry
+}
+
+// noteRequest records the expression of the request served by r and the
+// result or the error of its evaluation in the access log entry. Requests
+// that are not computed yet pass a Result without a mode.
+func noteRequest(r *http.Request, expression string, result calculator.Result, err error) {
+	entry := requestLogEntry(r)
+	entry.expression = expression
+	entry.noted = true
+	entry.err = err
+	if err == nil && result.Mode != "" {
+		entry.mode = result.Mode
+		entry.result = result.String()
+		if len(entry.result) > maxLoggedResult {
+			entry.result = entry.result[:maxLoggedResult] + "..."
+		}
+	}
+}
+
+// noteError records an error of a request that has no expression.
+func noteError(r *http.Request, err error) {
+	requestLogEntry(r).err = err
+}
+
+// statusWriter remembers the status of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func newRequestID() string {
+	var id [8]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
+
+// LogRequests logs every request served by handler with its ID, method,
+// path, status and latency, and the expression length and the result or
+// error kind of calculations. The expressions themselves are logged only
+// with log_expressions, as they may contain user data. Server errors are
+// logged at the error level, the rest at the info level.
+func LogRequests(logger *slog.Logger, log_expressions bool, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r, entry := withLogEntry(r)
+		writer := &statusWriter{ResponseWriter: w}
+		handler.ServeHTTP(writer, r)
+		if writer.status == 0 {
+			writer.status = http.StatusOK
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", writer.status),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if entry.noted {
+			attrs = append(attrs, slog.Int("expression_length", utf8.RuneCountInString(entry.expression)))
+			if log_expressions {
+				attrs = append(attrs, slog.String("expression", entry.expression))
+			}
+			if entry.result != "" {
+				attrs = append(attrs, slog.String("mode", string(entry.mode)), slog.String("result", entry.result))
+			}
+		}
+		if entry.err != nil {
+			attrs = append(attrs, slog.String("error", errorKind(entry.err)))
+		}
+		level := slog.LevelInfo
+		if writer.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
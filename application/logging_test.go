@@ -0,0 +1,130 @@
+package application
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogRequests(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		requestID      string
+		logExpressions bool
+		expected       map[string]interface{}
+		missing        []string
+	}{
+		{
+			name:     "result",
+			method:   http.MethodPost,
+			url:      "/api/v1/calculate",
+			body:     `{"expression":"2+2*2"}`,
+			expected: map[string]interface{}{"level": "INFO", "method": "POST", "path": "/api/v1/calculate", "status": 200.0, "expression_length": 5.0, "mode": "float", "result": "6"},
+			missing:  []string{"expression", "error"},
+		},
+		{
+			name:     "exact result",
+			method:   http.MethodPost,
+			url:      "/api/v1/calculate",
+			body:     `{"expression":"1/3+1/6","mode":"rational"}`,
+			expected: map[string]interface{}{"mode": "rational", "result": "1/2"},
+		},
+		{
+			name:     "long result is cut",
+			method:   http.MethodPost,
+			url:      "/api/v1/calculate",
+			body:     `{"expression":"10^200","mode":"rational"}`,
+			expected: map[string]interface{}{"result": "1" + strings.Repeat("0", 99) + "..."},
+		},
+		{
+			name:           "expression is logged on demand",
+			method:         http.MethodPost,
+			url:            "/api/v1/calculate",
+			body:           `{"expression":"√4"}`,
+			logExpressions: true,
+			expected:       map[string]interface{}{"expression": "√4", "expression_length": 2.0},
+		},
+		{
+			name:     "error kind",
+			method:   http.MethodPost,
+			url:      "/api/v1/calculate",
+			body:     `{"expression":"1/(2-2)"}`,
+			expected: map[string]interface{}{"status": 422.0, "error": "division by zero"},
+			missing:  []string{"result"},
+		},
+		{
+			name:     "syntax error kind",
+			method:   http.MethodPost,
+			url:      "/api/v1/calculate",
+			body:     `{"expression":"(1+2"}`,
+			expected: map[string]interface{}{"error": "incorrect count of brackets"},
+		},
+		{
+			name:     "bad request",
+			method:   http.MethodPost,
+			url:      "/api/v1/calculate",
+			body:     `{"expression"`,
+			expected: map[string]interface{}{"level": "INFO", "status": 400.0, "error": "invalid json request"},
+			missing:  []string{"expression_length", "result"},
+		},
+		{
+			name:      "request id of the client",
+			method:    http.MethodGet,
+			url:       "/api/v1/functions",
+			requestID: "abc",
+			expected:  map[string]interface{}{"request_id": "abc", "status": 200.0},
+			missing:   []string{"expression_length"},
+		},
+		{
+			name:     "not found",
+			method:   http.MethodGet,
+			url:      "/api/v1/expressions/7",
+			expected: map[string]interface{}{"status": 404.0},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			config := DefaultConfig()
+			config.LogFormat = "json"
+			config.LogExpressions = testCase.logExpressions
+			handler := newHandler(config, NewExpressions(NewMemoryStore(), 1, DefaultQueueSize), NewLogger(&logs, config), NewMetrics(), NewHealth(NewEvaluator(config.MaxExpressionLength)))
+			req := httptest.NewRequest(testCase.method, testCase.url, strings.NewReader(testCase.body))
+			if testCase.requestID != "" {
+				req.Header.Set(RequestIDHeader, testCase.requestID)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			var entry map[string]interface{}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatalf("log %q is not one JSON entry: %v", logs.String(), err)
+			}
+			if entry["msg"] != "request" {
+				t.Fatalf("logged %v", entry)
+			}
+			if id, _ := entry["request_id"].(string); id == "" || w.Header().Get(RequestIDHeader) != id {
+				t.Fatalf("request id %q answered as %q", id, w.Header().Get(RequestIDHeader))
+			}
+			if _, ok := entry["latency"]; !ok {
+				t.Fatalf("latency is not logged: %v", entry)
+			}
+			for key, value := range testCase.expected {
+				if entry[key] != value {
+					t.Fatalf("%s logged as %v want %v", key, entry[key], value)
+				}
+			}
+			for _, key := range testCase.missing {
+				if _, ok := entry[key]; ok {
+					t.Fatalf("%s is logged: %v", key, entry)
+				}
+			}
+		})
+	}
+}
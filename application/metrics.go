@@ -0,0 +1,177 @@
+package application
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+var (
+	latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	lengthBuckets  = []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+	tokenBuckets   = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000}
+)
+
+// histogram counts observations in buckets with the given upper bounds.
+type histogram struct {
+	bounds []float64
+	// counts has a bucket for every bound and one for +Inf, each counted
+	// on its own; write adds them up as Prometheus expects.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(value float64) {
+	i := 0
+	for i < len(h.bounds) && value > h.bounds[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sum += value
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name string, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, formatFloat(h.sum), name, h.count)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Metrics collects the statistics of the server exposed by Handler in the
+// Prometheus text format.
+type Metrics struct {
+	in_flight atomic.Int64
+
+	mu          sync.Mutex
+	evaluations uint64
+	errors      map[string]uint64
+	requests    map[int]uint64
+	latency     *histogram
+	lengths     *histogram
+	tokens      *histogram
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		errors:   map[string]uint64{ErrServer.Error(): 0, ErrUnknownFormat.Error(): 0, ErrExpressionTooLong.Error(): 0},
+		requests: map[int]uint64{},
+		latency:  newHistogram(latencyBuckets),
+		lengths:  newHistogram(lengthBuckets),
+		tokens:   newHistogram(tokenBuckets),
+	}
+	for _, kind := range errorsToCheck {
+		m.errors[kind.Error()] = 0
+	}
+	return m
+}
+
+// Evaluator returns evaluate counting the evaluations, their errors by
+// kind, and the lengths and token counts of the expressions.
+func (m *Metrics) Evaluator(evaluate Evaluator) Evaluator {
+	return func(request *Request) (calculator.Result, error) {
+		result, err := evaluate(request)
+		length := utf8.RuneCountInString(request.Expression)
+		tokens, counted := expressionTokens(request, err)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.evaluations++
+		if err != nil {
+			m.errors[errorKind(err)]++
+		}
+		m.lengths.observe(float64(length))
+		if counted {
+			m.tokens.observe(float64(tokens))
+		}
+		return result, err
+	}
+}
+
+// expressionTokens returns the number of tokens of the expression of
+// request evaluated with err. Expressions over the length limit are not
+// tokenized, and float ones compiled by compute are not tokenized again.
+func expressionTokens(request *Request, err error) (int, bool) {
+	if errors.Is(err, ErrExpressionTooLong) {
+		return 0, false
+	}
+	mode := calculator.Mode(request.Mode)
+	if mode == "" || mode == calculator.ModeFloat {
+		if program, ok := programs.Peek(request.Expression); ok {
+			return program.Tokens(), true
+		}
+	}
+	tokens, err := calculator.CountTokens(request.Expression)
+	return tokens, err == nil
+}
+
+// Instrument counts the requests served by handler by status code and
+// observes their latency and how many of them are in flight.
+func (m *Metrics) Instrument(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.in_flight.Add(1)
+		defer m.in_flight.Add(-1)
+		writer := &statusWriter{ResponseWriter: w}
+		handler(writer, r)
+		if writer.status == 0 {
+			writer.status = http.StatusOK
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.requests[writer.status]++
+		m.latency.observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(out, "# HELP calc_requests_total Requests to /api/v1/calculate by status code.\n# TYPE calc_requests_total counter\n")
+	for _, code := range slices.Sorted(maps.Keys(m.requests)) {
+		fmt.Fprintf(out, "calc_requests_total{code=\"%d\"} %d\n", code, m.requests[code])
+	}
+	fmt.Fprintf(out, "# HELP calc_requests_in_flight Requests to /api/v1/calculate being served.\n# TYPE calc_requests_in_flight gauge\n")
+	fmt.Fprintf(out, "calc_requests_in_flight %d\n", m.in_flight.Load())
+	m.latency.write(out, "calc_request_duration_seconds", "Latency of requests to /api/v1/calculate.")
+
+	fmt.Fprintf(out, "# HELP calc_evaluations_total Evaluated expressions.\n# TYPE calc_evaluations_total counter\n")
+	fmt.Fprintf(out, "calc_evaluations_total %d\n", m.evaluations)
+	fmt.Fprintf(out, "# HELP calc_errors_total Failed evaluations by error.\n# TYPE calc_errors_total counter\n")
+	for _, kind := range slices.Sorted(maps.Keys(m.errors)) {
+		fmt.Fprintf(out, "calc_errors_total{error=\"%s\"} %d\n", labelEscaper.Replace(kind), m.errors[kind])
+	}
+	m.lengths.write(out, "calc_expression_length", "Length of evaluated expressions in characters.")
+	m.tokens.write(out, "calc_expression_tokens", "Number of tokens of evaluated expressions.")
+}
@@ -0,0 +1,90 @@
+package application
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxExpressionLength = 20
+	metrics := NewMetrics()
+	handler := newHandler(config, NewExpressions(NewMemoryStore(), 1, DefaultQueueSize), NewLogger(io.Discard, config), metrics, NewHealth(NewEvaluator(config.MaxExpressionLength)))
+	bodies := []string{
+		`{"expression":"2+2*2"}`,
+		`{"expression":"1/0"}`,
+		`{"expression":"1/(2-2)"}`,
+		`{"expression":"(1+2"}`,
+		`{"expression":"` + strings.Repeat("1+", 20) + `1"}`,
+		`{"expression"`,
+	}
+	for _, body := range bodies {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/calculate", bytes.NewBufferString(body)))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/calculate/batch", bytes.NewBufferString(`[{"expression":"1"},{"expression":"x"}]`)))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("metrics answered with %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	expectedLines := []string{
+		`calc_requests_total{code="200"} 1`,
+		`calc_requests_total{code="422"} 4`,
+		`calc_requests_total{code="400"} 1`,
+		`calc_requests_in_flight 0`,
+		`calc_request_duration_seconds_count 6`,
+		`calc_evaluations_total 7`,
+		`calc_errors_total{error="division by zero"} 2`,
+		`calc_errors_total{error="incorrect count of brackets"} 1`,
+		`calc_errors_total{error="expression is too long"} 1`,
+		`calc_errors_total{error="unbound identifier"} 1`,
+		`calc_errors_total{error="modulo by zero"} 0`,
+		`calc_expression_length_bucket{le="10"} 6`,
+		`calc_expression_length_bucket{le="25"} 6`,
+		`calc_expression_length_bucket{le="50"} 7`,
+		`calc_expression_length_bucket{le="+Inf"} 7`,
+		`calc_expression_length_count 7`,
+		`calc_expression_tokens_bucket{le="5"} 4`,
+		`calc_expression_tokens_bucket{le="10"} 5`,
+		`calc_expression_tokens_count 5`,
+		`calc_expression_tokens_sum 17`,
+	}
+	lines := strings.Split(w.Body.String(), "\n")
+	for _, expected := range expectedLines {
+		found := false
+		for _, line := range lines {
+			found = found || line == expected
+		}
+		if !found {
+			t.Fatalf("metrics do not have %q:\n%s", expected, w.Body.String())
+		}
+	}
+}
+
+func TestMetricsInFlight(t *testing.T) {
+	metrics := NewMetrics()
+	inside := make(chan struct{})
+	release := make(chan struct{})
+	handler := metrics.Instrument(func(w http.ResponseWriter, r *http.Request) {
+		close(inside)
+		<-release
+	})
+	done := make(chan struct{})
+	go func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/calculate", nil))
+		close(done)
+	}()
+	<-inside
+	w := httptest.NewRecorder()
+	metrics.Handler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	close(release)
+	<-done
+	if !strings.Contains(w.Body.String(), "\ncalc_requests_in_flight 1\n") {
+		t.Fatalf("in-flight request is not counted:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,121 @@
+package application
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+var (
+	ErrMethodNotAllowed     = errors.New("method not allowed")
+	ErrUnsupportedMediaType = errors.New("unsupported content type, expected application/json")
+	ErrBodyTooLarge         = errors.New("request body is too large")
+	ErrNotFound             = errors.New("not found")
+)
+
+// httpStatus returns the status of the response to err.
+func httpStatus(err error) int {
+	var syntaxErr *calculator.SyntaxError
+	switch {
+	case errors.Is(err, ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrExpressionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrMethodNotAllowed):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, ErrBodyTooLarge), errors.Is(err, ErrBatchTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrQueueFull):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ErrUnknownFormat), errors.Is(err, ErrExpressionTooLong), errors.Is(err, ErrUnknownOrder):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &syntaxErr):
+		return http.StatusUnprocessableEntity
+	}
+	for _, errToCheck := range errorsToCheck {
+		if errors.Is(err, errToCheck) {
+			return http.StatusUnprocessableEntity
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, answer interface{}) {
+	jsonBytes, err := json.Marshal(answer)
+	if err != nil {
+		writeError(w, ErrServer)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
+
+// writeError answers with err and the status of its type.
+func writeError(w http.ResponseWriter, err error) {
+	jsonBytes, status := TryMarshalError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
+
+// checkContentType returns ErrUnsupportedMediaType unless the body of r is
+// of one of types. A request without Content-Type is accepted.
+func checkContentType(r *http.Request, types ...string) error {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return nil
+	}
+	media_type, _, err := mime.ParseMediaType(header)
+	if err != nil || !slices.Contains(types, media_type) {
+		return ErrUnsupportedMediaType
+	}
+	return nil
+}
+
+// decodeJSON reads the JSON body of r into answer.
+func decodeJSON(r *http.Request, answer interface{}) error {
+	if err := checkContentType(r, "application/json"); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(r.Body).Decode(answer); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return ErrBodyTooLarge
+		}
+		return ErrInvalidInput
+	}
+	return nil
+}
+
+// handleMethods registers handlers of path by method and answers the other
+// methods with ErrMethodNotAllowed and the Allow header.
+func handleMethods(mux *http.ServeMux, path string, handlers map[string]http.HandlerFunc) {
+	var allowed []string
+	for method, handler := range handlers {
+		mux.HandleFunc(method+" "+path, handler)
+		allowed = append(allowed, method)
+		if method == http.MethodGet {
+			allowed = append(allowed, http.MethodHead)
+		}
+	}
+	slices.Sort(allowed)
+	allow := strings.Join(allowed, ", ")
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		writeError(w, ErrMethodNotAllowed)
+	})
+}
+
+// NotFoundHandler answers requests to unknown paths.
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, ErrNotFound)
+}
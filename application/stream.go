@@ -0,0 +1,181 @@
+package application
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MaxStreamLine is the longest line accepted by the stream handler.
+const MaxStreamLine = 1 << 20
+
+var ErrUnknownOrder = errors.New("unknown result order")
+
+type streamJob struct {
+	index   int
+	request *Request
+	err     error
+}
+
+// NewStreamHandler returns a handler that reads requests as newline
+// delimited JSON and writes a BatchResult line for each of them as soon as
+// it is computed by one of workers goroutines. With ?order=completion
+// results are written in the order they are computed, otherwise in the
+// order of requests.
+func NewStreamHandler(evaluate Evaluator, workers int) http.HandlerFunc {
+	if workers < 1 {
+		workers = 1
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		in_order := true
+		switch r.URL.Query().Get("order") {
+		case "", "input":
+		case "completion":
+			in_order = false
+		default:
+			writeError(w, ErrUnknownOrder)
+			return
+		}
+		if err := checkContentType(r, "application/x-ndjson", "application/json"); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		// Results are written while the body is still being read, for as
+		// long as the stream lasts.
+		controller := http.NewResponseController(w)
+		controller.EnableFullDuplex()
+		controller.SetReadDeadline(time.Time{})
+		controller.SetWriteDeadline(time.Time{})
+		flusher, _ := w.(http.Flusher)
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		// window limits the requests read but not yet written, so that
+		// neither the pending jobs nor the results waiting for their turn
+		// grow with the size of the stream.
+		window := make(chan struct{}, 2*workers)
+		jobs := make(chan streamJob)
+		results := make(chan BatchResult, cap(window))
+		read := make(chan struct{})
+		go func() {
+			defer close(read)
+			readStream(ctx, r, jobs, window)
+		}()
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for job := range jobs {
+					if job.err != nil {
+						answer := makeError(job.err)
+						results <- BatchResult{Index: job.index, AnswerBad: &answer}
+						continue
+					}
+					results <- answerRequest(evaluate, job.index, job.request)
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+		// The body must not be read once the handler returns, so when the
+		// client is gone or a write fails, the reader is stopped and waited
+		// for together with the workers.
+		defer func() {
+			cancel()
+			select {
+			case <-read:
+			default:
+				controller.SetReadDeadline(time.Now())
+				<-read
+			}
+			wg.Wait()
+		}()
+
+		encoder := json.NewEncoder(w)
+		pending := make(map[int]BatchResult)
+		next := 0
+		write := func(result BatchResult) bool {
+			<-window
+			if err := encoder.Encode(result); err != nil {
+				return false
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return true
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case result, ok := <-results:
+				if !ok {
+					return
+				}
+				if !in_order {
+					if !write(result) {
+						return
+					}
+					continue
+				}
+				pending[result.Index] = result
+				for {
+					result, ok := pending[next]
+					if !ok {
+						break
+					}
+					delete(pending, next)
+					next++
+					if !write(result) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// readStream sends the requests of the body to jobs, taking a slot of
+// window for each of them, and closes jobs at the end of the body or once
+// ctx is done.
+func readStream(ctx context.Context, r *http.Request, jobs chan<- streamJob, window chan struct{}) {
+	defer close(jobs)
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(nil, MaxStreamLine)
+	index := 0
+	send := func(job streamJob) bool {
+		select {
+		case window <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+		jobs <- job
+		index++
+		return true
+	}
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		job := streamJob{index: index, request: new(Request)}
+		if err := json.Unmarshal(line, job.request); err != nil {
+			job.err = ErrInvalidInput
+		}
+		if !send(job) {
+			return
+		}
+	}
+	if scanner.Err() != nil && ctx.Err() == nil {
+		send(streamJob{index: index, err: ErrInvalidInput})
+	}
+}
@@ -1,9 +1,53 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/Varman56/CalcServer.git/application"
+	"github.com/Varman56/CalcServer.git/distributed"
 )
 
 func main() {
-	application.RunServer()
+	config, err := application.LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Print(err)
+		os.Exit(2)
+	}
+	slog.SetDefault(application.NewLogger(os.Stderr, config))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	switch config.Mode {
+	case "server":
+		if err := application.NewApp(config).Run(ctx); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+	case "orchestrator":
+		orchestrator_config, err := distributed.OrchestratorConfigFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		orchestrator_config.Address = config.Address
+		orchestrator_config.ShutdownTimeout = config.ShutdownTimeout
+		if err := distributed.RunOrchestrator(ctx, orchestrator_config); err != nil {
+			log.Print(err)
+			os.Exit(1)
+		}
+	case "agent":
+		agent_config, err := distributed.AgentConfigFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+		distributed.NewAgent(agent_config).Run(ctx)
+	}
 }
@@ -0,0 +1,146 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+// DefaultPollInterval is how long an agent worker waits after finding no
+// tasks.
+const DefaultPollInterval = 100 * time.Millisecond
+
+type AgentConfig struct {
+	// Orchestrator is the base URL of the orchestrator.
+	Orchestrator string
+	// Workers is the number of tasks computed at the same time.
+	Workers      int
+	PollInterval time.Duration
+}
+
+// AgentConfigFromEnv reads the orchestrator URL from ORCHESTRATOR_URL and
+// the number of workers from COMPUTING_POWER.
+func AgentConfigFromEnv() (AgentConfig, error) {
+	config := AgentConfig{
+		Orchestrator: "http://localhost:8080",
+		PollInterval: DefaultPollInterval,
+	}
+	if url, ok := os.LookupEnv("ORCHESTRATOR_URL"); ok {
+		config.Orchestrator = url
+	}
+	workers, err := envInt("COMPUTING_POWER", 1)
+	if err != nil {
+		return AgentConfig{}, err
+	}
+	config.Workers = workers
+	return config, nil
+}
+
+// Agent computes the tasks of an orchestrator.
+type Agent struct {
+	config AgentConfig
+	client *http.Client
+}
+
+func NewAgent(config AgentConfig) *Agent {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+	return &Agent{config: config, client: &http.Client{}}
+}
+
+// Compute performs the operation of task.
+func Compute(task Task) TaskResult {
+	value, err := calculator.Eval(&calculator.BinaryOp{
+		Op:    task.Operation,
+		Left:  &calculator.Number{Value: task.Arg1},
+		Right: &calculator.Number{Value: task.Arg2},
+	})
+	if err != nil {
+		return TaskResult{ID: task.ID, Error: err.Error()}
+	}
+	return TaskResult{ID: task.ID, Result: value}
+}
+
+// Run computes tasks until ctx is done.
+func (a *Agent) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < a.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (a *Agent) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		task, ok := a.fetch(ctx)
+		if !ok {
+			sleep(ctx, a.config.PollInterval)
+			continue
+		}
+		if !sleep(ctx, time.Duration(task.OperationTime)*time.Millisecond) {
+			return
+		}
+		a.send(ctx, Compute(task))
+	}
+}
+
+func (a *Agent) fetch(ctx context.Context) (Task, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.config.Orchestrator+"/internal/task", nil)
+	if err != nil {
+		return Task{}, false
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return Task{}, false
+	}
+	defer res.Body.Close()
+	var answer AnswerTask
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&answer) != nil {
+		return Task{}, false
+	}
+	return answer.Task, true
+}
+
+// send reports result; if it is lost, the orchestrator hands the task out
+// again after its timeout.
+func (a *Agent) send(ctx context.Context, result TaskResult) {
+	jsonBytes, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.Orchestrator+"/internal/task", bytes.NewReader(jsonBytes))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := a.client.Do(req)
+	if err != nil {
+		return
+	}
+	res.Body.Close()
+}
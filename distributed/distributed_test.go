@@ -0,0 +1,164 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Varman56/CalcServer.git/application"
+)
+
+func TestCompute(t *testing.T) {
+	testCases := []struct {
+		task     Task
+		expected TaskResult
+	}{
+		{Task{ID: 1, Arg1: 2, Arg2: 3, Operation: "+"}, TaskResult{ID: 1, Result: 5}},
+		{Task{ID: 2, Arg1: 2, Arg2: 3, Operation: "^"}, TaskResult{ID: 2, Result: 8}},
+		{Task{ID: 3, Arg1: 7, Arg2: 2, Operation: "//"}, TaskResult{ID: 3, Result: 3}},
+		{Task{ID: 4, Arg1: 1, Arg2: 0, Operation: "/"}, TaskResult{ID: 4, Error: "division by zero"}},
+		{Task{ID: 5, Arg1: 1e308, Arg2: 10, Operation: "*"}, TaskResult{ID: 5, Error: "result is out of range"}},
+	}
+	for _, testCase := range testCases {
+		if result := Compute(testCase.task); result != testCase.expected {
+			t.Fatalf("%+v computed as %+v want %+v", testCase.task, result, testCase.expected)
+		}
+	}
+}
+
+func TestTaskHandlers(t *testing.T) {
+	orchestrator := NewOrchestrator(OrchestratorConfig{TaskTimeout: time.Hour})
+	handler := orchestrator.Handler()
+	do := func(method string, body string) (int, string) {
+		req := httptest.NewRequest(method, "/internal/task", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	if status, body := do(http.MethodGet, ""); status != http.StatusNotFound || body != `{"error":"no tasks available"}` {
+		t.Fatalf("empty queue answered with %d %s", status, body)
+	}
+	if status, body := do(http.MethodPost, `{"id":1,"result":2}`); status != http.StatusNotFound || body != `{"error":"task not found"}` {
+		t.Fatalf("unknown task answered with %d %s", status, body)
+	}
+	if status, body := do(http.MethodPost, `{"id":`); status != http.StatusUnprocessableEntity || body != `{"error":"invalid task result"}` {
+		t.Fatalf("invalid result answered with %d %s", status, body)
+	}
+
+	done := make(chan TaskResult)
+	go func() {
+		done <- orchestrator.compute("-", 5, 3)
+	}()
+	var status int
+	var body string
+	for status != http.StatusOK {
+		status, body = do(http.MethodGet, "")
+	}
+	if body != `{"task":{"id":1,"arg1":5,"arg2":3,"operation":"-","operation_time":0}}` {
+		t.Fatalf("task handed out as %s", body)
+	}
+	if status, body := do(http.MethodPost, `{"id":1,"result":2}`); status != http.StatusOK {
+		t.Fatalf("result answered with %d %s", status, body)
+	}
+	if result := <-done; result.Result != 2 {
+		t.Fatalf("operation computed as %v", result.Result)
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	orchestrator := NewOrchestrator(OrchestratorConfig{TaskTimeout: time.Millisecond})
+	go orchestrator.compute("+", 1, 2)
+	var first *task
+	for first == nil {
+		first, _ = orchestrator.next()
+	}
+	time.Sleep(2 * time.Millisecond)
+	again, ok := orchestrator.next()
+	if !ok || again.ID != first.ID {
+		t.Fatalf("task was not handed out again after its timeout")
+	}
+	orchestrator.finish(Compute(again.Task))
+}
+
+func TestOrchestratorWithAgents(t *testing.T) {
+	const duration = 100 * time.Millisecond
+	orchestrator := NewOrchestrator(OrchestratorConfig{
+		Durations: map[string]time.Duration{"+": duration, "*": duration, "/": duration},
+	})
+	server := httptest.NewServer(orchestrator.Handler())
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agent := NewAgent(AgentConfig{Orchestrator: server.URL, Workers: 4, PollInterval: time.Millisecond})
+	go agent.Run(ctx)
+
+	testCases := []struct {
+		name         string
+		body         string
+		expectedBody string
+	}{
+		{
+			name:         "independent operations",
+			body:         `{"expression":"(1+2)+(3+4)+(5+6)+(7+8)"}`,
+			expectedBody: `{"id":"1","expression":"(1+2)+(3+4)+(5+6)+(7+8)","status":"done","result":36}`,
+		},
+		{
+			name:         "functions and variables",
+			body:         `{"expression":"-sqrt(x*x + 9*2*2) - (x > 1 || 1/0)","variables":{"x":8}}`,
+			expectedBody: `{"id":"2","expression":"-sqrt(x*x + 9*2*2) - (x \u003e 1 || 1/0)","status":"done","result":-11}`,
+		},
+		{
+			name:         "division by zero",
+			body:         `{"expression":"2*2 + 1/(2*0)"}`,
+			expectedBody: `{"id":"3","expression":"2*2 + 1/(2*0)","status":"error","error":"division by zero","position":7,"token":"/"}`,
+		},
+		{
+			name:         "unbound variable",
+			body:         `{"expression":"2+y"}`,
+			expectedBody: `{"id":"4","expression":"2+y","status":"error","error":"unbound identifier: y","position":2,"token":"y"}`,
+		},
+		{
+			name:         "statements",
+			body:         `{"expression":"f(a) = a*2; f(3)"}`,
+			expectedBody: `{"id":"5","expression":"f(a) = a*2; f(3)","status":"done","result":6}`,
+		},
+	}
+	for _, testCase := range testCases {
+		start := time.Now()
+		res, err := http.Post(server.URL+"/api/v1/expressions", "application/json", bytes.NewBufferString(testCase.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var created application.AnswerCreated
+		json.NewDecoder(res.Body).Decode(&created)
+		res.Body.Close()
+
+		var answer struct {
+			Expression json.RawMessage `json:"expression"`
+		}
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			res, err := http.Get(server.URL + "/api/v1/expressions/" + created.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			json.NewDecoder(res.Body).Decode(&answer)
+			res.Body.Close()
+			if !strings.Contains(string(answer.Expression), `"pending"`) && !strings.Contains(string(answer.Expression), `"running"`) {
+				break
+			}
+		}
+		if string(answer.Expression) != testCase.expectedBody {
+			t.Fatalf("Test: %s\ngot %s want %s", testCase.name, answer.Expression, testCase.expectedBody)
+		}
+		// Seven additions in a row would take 7 durations, four of them
+		// are independent and computed at the same time.
+		if testCase.name == "independent operations" && time.Since(start) >= 6*duration {
+			t.Fatalf("independent operations were not computed in parallel: %v", time.Since(start))
+		}
+	}
+}
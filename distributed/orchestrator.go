@@ -0,0 +1,369 @@
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Varman56/CalcServer.git/application"
+	"github.com/Varman56/CalcServer.git/pkg/calculator"
+)
+
+// Task is a binary operation handed out to an agent.
+type Task struct {
+	ID            int     `json:"id"`
+	Arg1          float64 `json:"arg1"`
+	Arg2          float64 `json:"arg2"`
+	Operation     string  `json:"operation"`
+	OperationTime int64   `json:"operation_time"`
+}
+
+// TaskResult is sent back by the agent; Error is set if the operation
+// failed.
+type TaskResult struct {
+	ID     int     `json:"id"`
+	Result float64 `json:"result"`
+	Error  string  `json:"error,omitempty"`
+}
+
+type AnswerTask struct {
+	Task Task `json:"task"`
+}
+
+var (
+	ErrNoTasks       = errors.New("no tasks available")
+	ErrTaskNotFound  = errors.New("task not found")
+	ErrInvalidResult = errors.New("invalid task result")
+)
+
+// durationVariables are the environment variables with the simulated
+// time of operators, in milliseconds.
+var durationVariables = map[string]string{
+	"+":  "TIME_ADDITION_MS",
+	"-":  "TIME_SUBTRACTION_MS",
+	"*":  "TIME_MULTIPLICATIONS_MS",
+	"/":  "TIME_DIVISIONS_MS",
+	"//": "TIME_DIVISIONS_MS",
+	"%":  "TIME_DIVISIONS_MS",
+	"^":  "TIME_EXPONENTIATION_MS",
+}
+
+// DefaultTaskTimeout is how long an agent may compute a task before it is
+// handed out again.
+const DefaultTaskTimeout = time.Minute
+
+type OrchestratorConfig struct {
+	Address string
+	// Durations is the simulated time of each operator, sent to agents
+	// along with its tasks.
+	Durations   map[string]time.Duration
+	TaskTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests are waited for when
+	// RunOrchestrator stops.
+	ShutdownTimeout time.Duration
+}
+
+func envInt(name string, value int) (int, error) {
+	text, ok := os.LookupEnv(name)
+	if !ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil || value < 0 {
+		return 0, errors.New("invalid value of " + name + ": " + text)
+	}
+	return value, nil
+}
+
+// OrchestratorConfigFromEnv reads the operator durations from TIME_*_MS
+// environment variables.
+func OrchestratorConfigFromEnv() (OrchestratorConfig, error) {
+	config := OrchestratorConfig{
+		Address:     ":8080",
+		Durations:   make(map[string]time.Duration),
+		TaskTimeout: DefaultTaskTimeout,
+	}
+	for op, name := range durationVariables {
+		ms, err := envInt(name, 0)
+		if err != nil {
+			return OrchestratorConfig{}, err
+		}
+		config.Durations[op] = time.Duration(ms) * time.Millisecond
+	}
+	return config, nil
+}
+
+type task struct {
+	Task
+	deadline time.Time
+	done     chan TaskResult
+}
+
+// Orchestrator computes expressions by splitting them into binary
+// operations, which are computed by agents polling /internal/task.
+type Orchestrator struct {
+	config  OrchestratorConfig
+	mu      sync.Mutex
+	next_id int
+	queue   []*task
+	running map[int]*task
+}
+
+func NewOrchestrator(config OrchestratorConfig) *Orchestrator {
+	if config.TaskTimeout == 0 {
+		config.TaskTimeout = DefaultTaskTimeout
+	}
+	return &Orchestrator{config: config, running: make(map[int]*task)}
+}
+
+// compute hands the operation out to an agent and waits for its result.
+func (o *Orchestrator) compute(op string, left float64, right float64) TaskResult {
+	o.mu.Lock()
+	o.next_id++
+	t := &task{
+		Task: Task{
+			ID:            o.next_id,
+			Arg1:          left,
+			Arg2:          right,
+			Operation:     op,
+			OperationTime: o.config.Durations[op].Milliseconds(),
+		},
+		done: make(chan TaskResult, 1),
+	}
+	o.queue = append(o.queue, t)
+	o.mu.Unlock()
+	return <-t.done
+}
+
+// next returns the first queued task, or a running one whose agent did not
+// answer in time.
+func (o *Orchestrator) next() (*task, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	var t *task
+	if len(o.queue) > 0 {
+		t, o.queue = o.queue[0], o.queue[1:]
+	} else {
+		for _, running := range o.running {
+			if now.After(running.deadline) && (t == nil || running.ID < t.ID) {
+				t = running
+			}
+		}
+		if t == nil {
+			return nil, false
+		}
+	}
+	t.deadline = now.Add(o.config.TaskTimeout)
+	o.running[t.ID] = t
+	return t, true
+}
+
+func (o *Orchestrator) finish(result TaskResult) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	t, ok := o.running[result.ID]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	delete(o.running, result.ID)
+	t.done <- result
+	return nil
+}
+
+func writeError(w http.ResponseWriter, err error, status int) {
+	jsonBytes, _ := json.Marshal(application.AnswerBad{Error: err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
+
+func (o *Orchestrator) TaskHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	t, ok := o.next()
+	if !ok {
+		writeError(w, ErrNoTasks, http.StatusNotFound)
+		return
+	}
+	jsonBytes, err := json.Marshal(AnswerTask{Task: t.Task})
+	if err != nil {
+		writeError(w, application.ErrServer, http.StatusInternalServerError)
+		return
+	}
+	w.Write(jsonBytes)
+}
+
+func (o *Orchestrator) ResultHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	w.Header().Set("Content-Type", "application/json")
+	var result TaskResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		writeError(w, ErrInvalidResult, http.StatusUnprocessableEntity)
+		return
+	}
+	if err := o.finish(result); err != nil {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Evaluate computes a float mode request, sending the binary operations
+// of the expression to agents. Operands of an operation are computed
+// concurrently; unary operators, function calls and expressions with
+// statements are computed by the orchestrator itself.
+func (o *Orchestrator) Evaluate(request *application.Request) (calculator.Result, error) {
+	mode := calculator.Mode(request.Mode)
+	if mode != "" && mode != calculator.ModeFloat {
+		return calculator.Result{}, calculator.ErrUnsupportedInMode
+	}
+	node, err := calculator.Parse(request.Expression)
+	if err != nil {
+		return calculator.Result{}, err
+	}
+	var value float64
+	switch node.(type) {
+	case *calculator.Sequence, *calculator.Assignment, *calculator.FunctionDef:
+		value, err = calculator.EvalWithVariables(node, request.Variables)
+	default:
+		value, err = o.eval(node, request.Variables)
+	}
+	if err != nil {
+		return calculator.Result{}, err
+	}
+	return calculator.Result{Mode: calculator.ModeFloat, Float: value, Boolean: calculator.IsBoolean(node)}, nil
+}
+
+func number(value float64, position int) *calculator.Number {
+	return &calculator.Number{Value: value, Position: position}
+}
+
+func truth(value float64) float64 {
+	if value != 0 {
+		return 1
+	}
+	return 0
+}
+
+// evalAll computes nodes concurrently and returns the first error in the
+// order of nodes.
+func (o *Orchestrator) evalAll(nodes []calculator.Node, variables map[string]float64) ([]calculator.Node, error) {
+	values := make([]calculator.Node, len(nodes))
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := o.eval(node, variables)
+			values[i], errs[i] = number(value, node.Pos()), err
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+func (o *Orchestrator) eval(node calculator.Node, variables map[string]float64) (float64, error) {
+	switch n := node.(type) {
+	case *calculator.Group:
+		return o.eval(n.Inner, variables)
+	case *calculator.Conditional:
+		condition, err := o.eval(n.Condition, variables)
+		if err != nil {
+			return 0, err
+		}
+		if condition != 0 {
+			return o.eval(n.Then, variables)
+		}
+		return o.eval(n.Else, variables)
+	case *calculator.UnaryOp:
+		operand, err := o.eval(n.Operand, variables)
+		if err != nil {
+			return 0, err
+		}
+		return calculator.Eval(&calculator.UnaryOp{Op: n.Op, Operand: number(operand, n.Operand.Pos()), Position: n.Position})
+	case *calculator.Call:
+		args, err := o.evalAll(n.Args, variables)
+		if err != nil {
+			return 0, err
+		}
+		return calculator.Eval(&calculator.Call{Name: n.Name, Args: args, Position: n.Position})
+	case *calculator.BinaryOp:
+		switch n.Op {
+		case "&&", "||":
+			left, err := o.eval(n.Left, variables)
+			if err != nil {
+				return 0, err
+			}
+			if (left != 0) == (n.Op == "||") {
+				return truth(left), nil
+			}
+			right, err := o.eval(n.Right, variables)
+			return truth(right), err
+		}
+		operands, err := o.evalAll([]calculator.Node{n.Left, n.Right}, variables)
+		if err != nil {
+			return 0, err
+		}
+		left, right := operands[0].(*calculator.Number), operands[1].(*calculator.Number)
+		result := o.compute(n.Op, left.Value, right.Value)
+		if result.Error != "" {
+			// Agents only report the message, the error itself is built
+			// here so that it points at the operator.
+			_, err := calculator.Eval(&calculator.BinaryOp{Op: n.Op, Left: left, Right: right, Position: n.Position})
+			if err == nil {
+				err = application.ErrServer
+			}
+			return 0, err
+		}
+		return result.Result, nil
+	}
+	return calculator.EvalWithVariables(node, variables)
+}
+
+// Handler serves the asynchronous expressions API computed by agents and
+// the internal task API.
+func (o *Orchestrator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	expressions := application.NewExpressions(application.NewMemoryStore(), application.DefaultBatchWorkers, application.DefaultQueueSize)
+	expressions.Evaluate = o.Evaluate
+	expressions.Register(mux, application.DefaultMaxBodySize)
+	mux.HandleFunc("GET /internal/task", o.TaskHandler)
+	mux.HandleFunc("POST /internal/task", o.ResultHandler)
+	mux.HandleFunc("GET /healthz", application.HealthHandler)
+	mux.HandleFunc("GET /version", application.VersionHandler)
+	mux.HandleFunc("/", application.NotFoundHandler)
+	return mux
+}
+
+// RunOrchestrator serves the orchestrator until ctx is done, then shuts the
+// server down gracefully.
+func RunOrchestrator(ctx context.Context, config OrchestratorConfig) error {
+	server := &http.Server{Addr: config.Address, Handler: NewOrchestrator(config).Handler()}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown_ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdown_ctx); err != nil {
+		server.Close()
+		return err
+	}
+	return nil
+}
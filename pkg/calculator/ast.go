@@ -0,0 +1,176 @@
+package calculator
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node is an element of the expression tree produced by Parse.
+// Pos returns the rune offset of the node in the source expression.
+type Node interface {
+	Pos() int
+	String() string
+}
+
+// Number is a numeric literal; an imaginary one such as "4i" has Value 4.
+type Number struct {
+	Value     float64
+	Imaginary bool
+	Literal   string
+	Position  int
+}
+
+type Identifier struct {
+	Name     string
+	Position int
+}
+
+type BinaryOp struct {
+	Op       string
+	Left     Node
+	Right    Node
+	Position int
+}
+
+type UnaryOp struct {
+	Op       string
+	Operand  Node
+	Position int
+}
+
+type Group struct {
+	Inner    Node
+	Position int
+}
+
+// Conditional is "Condition ? Then : Else".
+type Conditional struct {
+	Condition Node
+	Then      Node
+	Else      Node
+	Position  int
+}
+
+// Assignment is "Name = Value"; it evaluates to Value.
+type Assignment struct {
+	Name     string
+	Value    Node
+	Position int
+}
+
+// FunctionDef is "Name(Params) = Body", a function local to the
+// expression it is defined in.
+type FunctionDef struct {
+	Name     string
+	Params   []string
+	Body     Node
+	Position int
+}
+
+// Sequence is a list of statements separated by ";". Its value is the
+// value of the last statement.
+type Sequence struct {
+	Statements []Node
+}
+
+type Call struct {
+	Name     string
+	Args     []Node
+	Position int
+}
+
+func (n *Number) Pos() int      { return n.Position }
+func (n *Identifier) Pos() int  { return n.Position }
+func (n *BinaryOp) Pos() int    { return n.Position }
+func (n *UnaryOp) Pos() int     { return n.Position }
+func (n *Group) Pos() int       { return n.Position }
+func (n *Call) Pos() int        { return n.Position }
+func (n *Conditional) Pos() int { return n.Position }
+func (n *Assignment) Pos() int  { return n.Position }
+func (n *FunctionDef) Pos() int { return n.Position }
+func (n *Sequence) Pos() int    { return n.Statements[0].Pos() }
+
+func (n *Number) String() string {
+	if n.Literal != "" {
+		return n.Literal
+	}
+	if n.Imaginary {
+		return strconv.FormatFloat(n.Value, 'g', -1, 64) + "i"
+	}
+	return strconv.FormatFloat(n.Value, 'g', -1, 64)
+}
+
+func (n *Identifier) String() string {
+	return n.Name
+}
+
+func (n *BinaryOp) String() string {
+	return "(" + n.Left.String() + " " + n.Op + " " + n.Right.String() + ")"
+}
+
+func (n *UnaryOp) String() string {
+	return "(" + n.Op + n.Operand.String() + ")"
+}
+
+func (n *Group) String() string {
+	return "(" + n.Inner.String() + ")"
+}
+
+func (n *Call) String() string {
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		args[i] = arg.String()
+	}
+	return n.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (n *Conditional) String() string {
+	return "(" + n.Condition.String() + " ? " + n.Then.String() + " : " + n.Else.String() + ")"
+}
+
+func (n *Assignment) String() string {
+	return n.Name + " = " + n.Value.String()
+}
+
+func (n *FunctionDef) String() string {
+	return n.Name + "(" + strings.Join(n.Params, ", ") + ") = " + n.Body.String()
+}
+
+func (n *Sequence) String() string {
+	statements := make([]string, len(n.Statements))
+	for i, statement := range n.Statements {
+		statements[i] = statement.String()
+	}
+	return strings.Join(statements, "; ")
+}
+
+var booleanOperators = map[string]bool{
+	"==": true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+	"&&": true,
+	"||": true,
+	"!":  true,
+}
+
+// IsBoolean reports whether node always evaluates to a boolean 1 or 0.
+func IsBoolean(node Node) bool {
+	switch n := node.(type) {
+	case *BinaryOp:
+		return booleanOperators[n.Op]
+	case *UnaryOp:
+		return booleanOperators[n.Op]
+	case *Group:
+		return IsBoolean(n.Inner)
+	case *Conditional:
+		return IsBoolean(n.Then) && IsBoolean(n.Else)
+	case *Assignment:
+		return IsBoolean(n.Value)
+	case *Sequence:
+		return IsBoolean(n.Statements[len(n.Statements)-1])
+	}
+	return false
+}
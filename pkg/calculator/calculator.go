@@ -2,8 +2,6 @@ package calculator
 
 import (
 	"errors"
-	"strconv"
-	"unicode"
 )
 
 var (
@@ -13,207 +11,65 @@ var (
 	ErrInvalidExpression        = errors.New("invalid expression")
 	ErrConvertingToFloat64      = errors.New("failure to convert to float64")
 	ErrUndefinedOperand         = errors.New("undefined operand")
+	ErrInvalidPower             = errors.New("invalid operands for exponentiation")
+	ErrModuloByZero             = errors.New("modulo by zero")
+	ErrUnknownFunction          = errors.New("unknown function")
+	ErrTooFewArguments          = errors.New("too few arguments for function")
+	ErrTooManyArguments         = errors.New("too many arguments for function")
+	ErrFunctionDomain           = errors.New("argument out of function domain")
+	ErrUnboundIdentifier        = errors.New("unbound identifier")
+	ErrReservedName             = errors.New("name is reserved")
+	ErrMalformedExponent        = errors.New("malformed exponent in number")
+	ErrInvalidDigit             = errors.New("invalid digit in number")
+	ErrMisplacedSeparator       = errors.New("misplaced digit separator in number")
+	ErrUnknownMode              = errors.New("unknown evaluation mode")
+	ErrInvalidPrecision         = errors.New("precision is out of range")
+	ErrUnsupportedInMode        = errors.New("operation is not supported in this evaluation mode")
+	ErrIrrational               = errors.New("result is not a rational number")
+	ErrNotInteger               = errors.New("value is not an integer")
+	ErrIntegerOverflow          = errors.New("integer overflow")
+	ErrInvalidShift             = errors.New("shift count is out of range")
+	ErrInvalidDefinition        = errors.New("invalid assignment or function definition")
+	ErrRecursionDepth           = errors.New("maximum recursion depth exceeded")
+	ErrTooManySteps             = errors.New("evaluation takes too many steps")
+	ErrNoResult                 = errors.New("expression has no result")
+	ErrOverflow                 = errors.New("result is out of range")
 )
 
-type Token struct {
-	is_num  bool
-	operand rune
-	num     float64
+// SyntaxError describes where an expression went wrong. It wraps one of the
+// sentinel errors above, so errors.Is keeps working, and its message is the
+// message of the wrapped sentinel.
+type SyntaxError struct {
+	Err      error
+	Position int
+	Token    string
+	Expected []string
 }
 
-type Expression interface {
-	ParsingExpression()
-	CalculateExpression([]Token) (int, interface{})
+func (e *SyntaxError) Error() string {
+	return e.Err.Error()
 }
 
-type Arithmetic struct {
-	expression            string
-	parsed_expression     []Token
-	result                float64
-	is_invalid_expression bool
-	err                   error
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
 }
 
-func (e *Arithmetic) setError(err error) {
-	e.is_invalid_expression = true
-	e.err = err
+func newSyntaxError(err error, position int, token string, expected ...string) *SyntaxError {
+	return &SyntaxError{Err: err, Position: position, Token: token, Expected: expected}
 }
 
-func isOperand(char rune) bool {
-	switch char {
-	case '+':
-		return true
-	case '-':
-		return true
-	case '*':
-		return true
-	case '/':
-		return true
-	default:
-		return false
-	}
-}
-
-func (e *Arithmetic) ParsingExpression() {
-	var brackets_balance int = 0
-	var result_expression []Token
-	var index int = 0
-	var last_digit_index int = 0
-	expr := []rune(e.expression)
-	for ; index < len(expr); index++ {
-		var symbol rune = expr[index]
-		switch {
-		case symbol == '(':
-			if len(result_expression) > 0 && !result_expression[len(result_expression)-1].is_num && result_expression[len(result_expression)-1].operand == ')' {
-				result_expression = append(result_expression, Token{operand: '*'})
-			}
-			brackets_balance++
-			result_expression = append(result_expression, Token{operand: '('})
-		case symbol == ')':
-			if brackets_balance--; brackets_balance < 0 {
-				e.setError(ErrIncorrectBracketSequence)
-				return
-			}
-			result_expression = append(result_expression, Token{operand: ')'})
-		case isOperand(symbol):
-			if len(result_expression) > 0 && !result_expression[len(result_expression)-1].is_num && isOperand(result_expression[len(result_expression)-1].operand) {
-				e.setError(ErrMultipleOperands)
-				return
-			}
-			result_expression = append(result_expression, Token{operand: symbol})
-		case unicode.IsDigit(symbol):
-			last_digit_index = index + 1
-			for last_digit_index < len(expr) && (unicode.IsDigit(expr[last_digit_index]) || expr[last_digit_index] == '.') {
-				last_digit_index++
-			}
-			num, err := strconv.ParseFloat(e.expression[index:last_digit_index], 64)
-			if err != nil {
-				e.setError(ErrConvertingToFloat64)
-				return
-			}
-			if len(result_expression) > 0 && !result_expression[len(result_expression)-1].is_num && result_expression[len(result_expression)-1].operand == ')' {
-				result_expression = append(result_expression, Token{operand: '*'})
-			}
-			result_expression = append(result_expression, Token{is_num: true, num: num})
-			index = last_digit_index - 1
-		default:
-			e.setError(ErrUndefinedOperand)
-			return
-		}
-	}
-	if brackets_balance != 0 {
-		e.setError(ErrIncorrectBracketSequence)
-		return
-	}
-	e.parsed_expression = result_expression
-}
-
-func makeOperations(cleared_tokens []Token, high_priority bool) ([]Token, error) {
-	var result_tokens []Token
-	if high_priority {
-		var index int = 0
-		for ; index < len(cleared_tokens); index++ {
-			token := cleared_tokens[index]
-			switch token.operand {
-			case '*':
-				if len(result_tokens) == 0 || !result_tokens[len(result_tokens)-1].is_num ||
-					index == len(cleared_tokens)-1 || !cleared_tokens[index+1].is_num {
-					return cleared_tokens, ErrMultipleOperands
-				}
-				result_tokens[len(result_tokens)-1].num *= cleared_tokens[index+1].num
-				index += 1
-			case '/':
-				if len(result_tokens) == 0 || !result_tokens[len(result_tokens)-1].is_num ||
-					index == len(cleared_tokens)-1 || !cleared_tokens[index+1].is_num {
-					return cleared_tokens, ErrMultipleOperands
-				}
-				if cleared_tokens[index+1].num == 0 {
-					return cleared_tokens, ErrDivisionByZero
-				}
-				result_tokens[len(result_tokens)-1].num /= cleared_tokens[index+1].num
-				index += 1
-			default:
-				result_tokens = append(result_tokens, cleared_tokens[index])
-			}
-		}
-		return result_tokens, nil
-	}
-	var next_coef float64 = 1
-	for _, token := range cleared_tokens {
-		switch {
-		case token.operand == '-':
-			next_coef *= -1
-		case token.is_num:
-			result_tokens = append(result_tokens, Token{is_num: true, num: token.num * next_coef})
-			next_coef = 1
-		case token.operand == '+':
-			continue
-		default:
-			return cleared_tokens, ErrUndefinedOperand
-		}
-	}
-	result := make([]Token, 1)
-	result[0].is_num = true
-	for _, token := range result_tokens {
-		result[0].num += token.num
-	}
-	return result, nil
-}
-
-func (e *Arithmetic) CalculateExpression(expr []Token) (int, interface{}) {
-	if len(expr) == 0 {
-		e.setError(ErrInvalidExpression)
-		return 0, 0
-	}
-	var cleared_expr []Token
-	var index int = 0
-	var break_condition bool = false
-	for ; index < len(expr); index++ {
-		switch expr[index].operand {
-		case '(':
-			jump_index, inside_expr := e.CalculateExpression(expr[index+1:])
-			inside_float, ok := inside_expr.(float64)
-			if !ok {
-				e.setError(ErrInvalidExpression)
-				return 0, 0
-			}
-			cleared_expr = append(cleared_expr, Token{num: inside_float, is_num: true})
-			index += jump_index
-		case ')':
-			break_condition = true
-		default:
-			cleared_expr = append(cleared_expr, expr[index])
-		}
-		if break_condition {
-			break
-		}
-	}
-	if e.is_invalid_expression {
-		return 0, 0
-	}
-	high_priority_calced, err := makeOperations(cleared_expr, true)
-	if err != nil {
-		e.setError(err)
-		return 0, 0
-	}
-	res, err := makeOperations(high_priority_calced, false)
+func Calc(expression string) (float64, error) {
+	node, err := Parse(expression)
 	if err != nil {
-		e.setError(err)
-		return 0, 0
+		return 0, err
 	}
-	e.result = res[0].num
-	return index + 1, res[0].num
+	return Eval(node)
 }
 
-func Calc(expression string) (float64, error) {
-	arithmetic := Arithmetic{expression: expression}
-	arithmetic.ParsingExpression()
-	if arithmetic.is_invalid_expression {
-		return 0, arithmetic.err
-	}
-	arithmetic.CalculateExpression(arithmetic.parsed_expression)
-	if arithmetic.is_invalid_expression {
-		return 0, arithmetic.err
+func CalcWithVariables(expression string, variables map[string]float64) (float64, error) {
+	node, err := Parse(expression)
+	if err != nil {
+		return 0, err
 	}
-	return arithmetic.result, nil
+	return EvalWithVariables(node, variables)
 }
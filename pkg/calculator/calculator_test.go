@@ -1,7 +1,11 @@
 package calculator
 
 import (
+	"errors"
+	"fmt"
 	"math"
+	"math/cmplx"
+	"strings"
 	"testing"
 )
 
@@ -114,6 +118,120 @@ func TestCalc(t *testing.T) {
 			expectedResult: -30.0721649485,
 			wantError:      false,
 		},
+		{
+			name:           "power",
+			expression:     "2*3^2",
+			expectedResult: 18,
+			wantError:      false,
+		},
+		{
+			name:           "power right associativity",
+			expression:     "2^3^2",
+			expectedResult: 512,
+			wantError:      false,
+		},
+		{
+			name:           "modulo",
+			expression:     "7%4+1",
+			expectedResult: 4,
+			wantError:      false,
+		},
+		{
+			name:           "integer division",
+			expression:     "7//2*2",
+			expectedResult: 6,
+			wantError:      false,
+		},
+		{
+			name:           "integer division negative",
+			expression:     "(0-7)//2",
+			expectedResult: -4,
+			wantError:      false,
+		},
+		{
+			name:           "zero to negative power",
+			expression:     "0^(0-1)",
+			expectedResult: 0,
+			wantError:      true,
+		},
+		{
+			name:           "negative base fractional power",
+			expression:     "(0-8)^(1/3)",
+			expectedResult: 0,
+			wantError:      true,
+		},
+		{
+			name:           "modulo by zero",
+			expression:     "5%0",
+			expectedResult: 0,
+			wantError:      true,
+		},
+		{
+			name:           "integer division by zero",
+			expression:     "5//0",
+			expectedResult: 0,
+			wantError:      true,
+		},
+		{
+			name:           "function",
+			expression:     "sqrt(16)+abs(2-5)",
+			expectedResult: 7,
+			wantError:      false,
+		},
+		{
+			name:           "nested functions",
+			expression:     "max(1, min(7, 3^2), sum(1,2), avg(2, 4))*2",
+			expectedResult: 14,
+			wantError:      false,
+		},
+		{
+			name:           "function implicit mult",
+			expression:     "2cos(0)(3)",
+			expectedResult: 6,
+			wantError:      false,
+		},
+		{
+			name:           "log base",
+			expression:     "log(100)+log(8, 2)",
+			expectedResult: 5,
+			wantError:      false,
+		},
+		{
+			name:           "unknown function",
+			expression:     "foo(1)",
+			expectedResult: 0,
+			wantError:      true,
+		},
+		{
+			name:           "too few arguments",
+			expression:     "atan2(1)",
+			expectedResult: 0,
+			wantError:      true,
+		},
+		{
+			name:           "too many arguments",
+			expression:     "sin(1, 2)",
+			expectedResult: 0,
+			wantError:      true,
+		},
+		{
+			name:           "function domain",
+			expression:     "sqrt(0-1)",
+			expectedResult: 0,
+			wantError:      true,
+		},
+		{
+			name:           "constants",
+			expression:     "cos(pi)+ln(e)+2phi-phi^2",
+			expectedResult: -1 + 1 + 2*math.Phi - math.Phi*math.Phi,
+			wantError:      false,
+		},
+		{
+			name:           "unbound identifier",
+			expression:     "x+1",
+			expectedResult: 0,
+			wantError:      true,
+		},
 		{
 			name:           "division by zero",
 			expression:     "24/0",
@@ -167,3 +285,1486 @@ func TestCalc(t *testing.T) {
 		})
 	}
 }
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name         string
+		expression   string
+		expectedTree string
+		expectedErr  error
+	}{
+		{
+			name:         "precedence",
+			expression:   "1+2*3",
+			expectedTree: "(1 + (2 * 3))",
+		},
+		{
+			name:         "left associativity",
+			expression:   "8-4-2",
+			expectedTree: "((8 - 4) - 2)",
+		},
+		{
+			name:         "group",
+			expression:   "(1+2)*3",
+			expectedTree: "(((1 + 2)) * 3)",
+		},
+		{
+			name:         "unary",
+			expression:   "-(2)",
+			expectedTree: "(-(2))",
+		},
+		{
+			name:         "implicit mult",
+			expression:   "(7)(5)",
+			expectedTree: "((7) * (5))",
+		},
+		{
+			name:         "spaces",
+			expression:   " 1 +\t2 ",
+			expectedTree: "(1 + 2)",
+		},
+		{
+			name:         "power associativity",
+			expression:   "2^3^2",
+			expectedTree: "(2 ^ (3 ^ 2))",
+		},
+		{
+			name:         "multiplicative associativity",
+			expression:   "9//2%3*4",
+			expectedTree: "(((9 // 2) % 3) * 4)",
+		},
+		{
+			name:         "power above unary",
+			expression:   "-2^2",
+			expectedTree: "(-(2 ^ 2))",
+		},
+		{
+			name:         "call",
+			expression:   "max(1, 2+3, min())",
+			expectedTree: "max(1, (2 + 3), min())",
+		},
+		{
+			name:         "identifier",
+			expression:   "2x+sin",
+			expectedTree: "((2 * x) + sin)",
+		},
+		{
+			name:        "trailing comma",
+			expression:  "max(1,)",
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "missing operand",
+			expression:  "2*",
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "closing bracket first",
+			expression:  ")(",
+			expectedErr: ErrIncorrectBracketSequence,
+		},
+		{
+			name:        "operators in a row",
+			expression:  "2*/3",
+			expectedErr: ErrMultipleOperands,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			node, err := Parse(testCase.expression)
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if node.String() != testCase.expectedTree {
+				t.Fatalf("%s parsed as %s want %s", testCase.expression, node.String(), testCase.expectedTree)
+			}
+		})
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	testCases := []struct {
+		name             string
+		expression       string
+		expectedErr      error
+		expectedPosition int
+		expectedToken    string
+	}{
+		{
+			name:             "division by zero",
+			expression:       "1+24/0",
+			expectedErr:      ErrDivisionByZero,
+			expectedPosition: 4,
+			expectedToken:    "/",
+		},
+		{
+			name:             "unclosed bracket",
+			expression:       "(1+(2+3)",
+			expectedErr:      ErrIncorrectBracketSequence,
+			expectedPosition: 0,
+			expectedToken:    "(",
+		},
+		{
+			name:             "extra closing bracket",
+			expression:       "1+2)",
+			expectedErr:      ErrIncorrectBracketSequence,
+			expectedPosition: 3,
+			expectedToken:    ")",
+		},
+		{
+			name:             "multiple operands",
+			expression:       "2+*3",
+			expectedErr:      ErrMultipleOperands,
+			expectedPosition: 2,
+			expectedToken:    "*",
+		},
+		{
+			name:             "undefined operand",
+			expression:       "2 & 3",
+			expectedErr:      ErrUndefinedOperand,
+			expectedPosition: 2,
+			expectedToken:    "&",
+		},
+		{
+			name:             "runes offset",
+			expression:       "(ё#)",
+			expectedErr:      ErrUndefinedOperand,
+			expectedPosition: 2,
+			expectedToken:    "#",
+		},
+		{
+			name:             "too many arguments",
+			expression:       "1 + sqrt(4, 9)",
+			expectedErr:      ErrTooManyArguments,
+			expectedPosition: 4,
+			expectedToken:    "sqrt",
+		},
+		{
+			name:             "bad number",
+			expression:       "2+2..2",
+			expectedErr:      ErrConvertingToFloat64,
+			expectedPosition: 2,
+			expectedToken:    "2..2",
+		},
+		{
+			name:             "number out of range",
+			expression:       "2+1e400",
+			expectedErr:      ErrConvertingToFloat64,
+			expectedPosition: 2,
+			expectedToken:    "1e400",
+		},
+		{
+			name:             "hex number out of range",
+			expression:       "0x1_0000_0000_0000_0000",
+			expectedErr:      ErrConvertingToFloat64,
+			expectedPosition: 0,
+			expectedToken:    "0x1_0000_0000_0000_0000",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := Calc(testCase.expression)
+			if !errors.Is(err, testCase.expectedErr) {
+				t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+			}
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("%s: error %v is not a *SyntaxError", testCase.expression, err)
+			}
+			if syntaxErr.Position != testCase.expectedPosition || syntaxErr.Token != testCase.expectedToken {
+				t.Fatalf("%s: got position %d token %q want %d %q", testCase.expression,
+					syntaxErr.Position, syntaxErr.Token, testCase.expectedPosition, testCase.expectedToken)
+			}
+			if err.Error() != testCase.expectedErr.Error() {
+				t.Fatalf("%s: message %q should be %q", testCase.expression, err.Error(), testCase.expectedErr.Error())
+			}
+		})
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	list := Functions()
+	for i := 1; i < len(list); i++ {
+		if list[i-1].Name >= list[i].Name {
+			t.Fatalf("functions are not sorted: %s before %s", list[i-1].Name, list[i].Name)
+		}
+	}
+	for _, function := range list {
+		if function.MinArgs < 0 || (function.MaxArgs != Variadic && function.MaxArgs < function.MinArgs) {
+			t.Fatalf("function %s has invalid arity %d..%d", function.Name, function.MinArgs, function.MaxArgs)
+		}
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	testCases := []struct {
+		expression string
+		expected   int
+	}{
+		{"", 0},
+		{"2+2*2", 5},
+		{"max(x, 2.5e3) // 4", 8},
+		{"1 <= 2 && 3i xor y", 7},
+	}
+	for _, testCase := range testCases {
+		count, err := CountTokens(testCase.expression)
+		if err != nil || count != testCase.expected {
+			t.Fatalf("%q has %d tokens, error %v, want %d", testCase.expression, count, err, testCase.expected)
+		}
+	}
+	if _, err := CountTokens("(1+2"); !errors.Is(err, ErrIncorrectBracketSequence) {
+		t.Fatalf("got error %v want %v", err, ErrIncorrectBracketSequence)
+	}
+}
+
+func TestCalcWithVariables(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		variables      map[string]float64
+		expectedResult float64
+		expectedErr    error
+	}{
+		{
+			name:           "simple",
+			expression:     "x*2+y",
+			variables:      map[string]float64{"x": 3, "y": 1},
+			expectedResult: 7,
+		},
+		{
+			name:        "implicit mult",
+			expression:  "2x(x_1)",
+			variables:   map[string]float64{"x": 3},
+			expectedErr: ErrUnknownFunction,
+		},
+		{
+			name:           "implicit mult with bracket",
+			expression:     "2x+(x)pi",
+			variables:      map[string]float64{"x": 3},
+			expectedResult: 6 + 3*math.Pi,
+		},
+		{
+			name:        "unbound",
+			expression:  "x*2+y",
+			variables:   map[string]float64{"x": 3},
+			expectedErr: ErrUnboundIdentifier,
+		},
+		{
+			name:        "constant redefinition",
+			expression:  "pi",
+			variables:   map[string]float64{"pi": 3},
+			expectedErr: ErrReservedName,
+		},
+	}
+	const EPS = 1e-9
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := CalcWithVariables(testCase.expression, testCase.variables)
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if math.Abs(val-testCase.expectedResult) > EPS {
+				t.Fatalf("%f should be equal %f", val, testCase.expectedResult)
+			}
+		})
+	}
+}
+
+func TestUnaryOperators(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		expectedTree   string
+		expectedResult float64
+	}{
+		{
+			name:           "after multiplication",
+			expression:     "2*-3",
+			expectedTree:   "(2 * (-3))",
+			expectedResult: -6,
+		},
+		{
+			name:           "below power",
+			expression:     "-2^2",
+			expectedTree:   "(-(2 ^ 2))",
+			expectedResult: -4,
+		},
+		{
+			name:           "power exponent",
+			expression:     "2^-1",
+			expectedTree:   "(2 ^ (-1))",
+			expectedResult: 0.5,
+		},
+		{
+			name:           "double minus",
+			expression:     "--3",
+			expectedTree:   "(-(-3))",
+			expectedResult: 3,
+		},
+		{
+			name:           "plus",
+			expression:     "+5",
+			expectedTree:   "(+5)",
+			expectedResult: 5,
+		},
+		{
+			name:           "group",
+			expression:     "-(1+2)",
+			expectedTree:   "(-((1 + 2)))",
+			expectedResult: -3,
+		},
+		{
+			name:           "nested groups",
+			expression:     "-(-2)",
+			expectedTree:   "(-((-2)))",
+			expectedResult: 2,
+		},
+		{
+			name:           "above multiplication",
+			expression:     "-2*3",
+			expectedTree:   "((-2) * 3)",
+			expectedResult: -6,
+		},
+		{
+			name:           "mixed chain",
+			expression:     "3/-+-2",
+			expectedTree:   "(3 / (-(+(-2))))",
+			expectedResult: 1.5,
+		},
+		{
+			name:           "function argument",
+			expression:     "max(-1, -2)",
+			expectedTree:   "max((-1), (-2))",
+			expectedResult: -1,
+		},
+	}
+	const EPS = 1e-9
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			node, err := Parse(testCase.expression)
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if node.String() != testCase.expectedTree {
+				t.Fatalf("%s parsed as %s want %s", testCase.expression, node.String(), testCase.expectedTree)
+			}
+			val, err := Eval(node)
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if math.Abs(val-testCase.expectedResult) > EPS {
+				t.Fatalf("%f should be equal %f", val, testCase.expectedResult)
+			}
+		})
+	}
+	for _, expression := range []string{"2++3", "2--3", "2+-3", "2*", "-"} {
+		if _, err := Calc(expression); err == nil {
+			t.Fatalf("bad case %s don't return error", expression)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		expectedResult float64
+		expectedErr    error
+	}{
+		{
+			name:           "negative exponent",
+			expression:     "1e-9",
+			expectedResult: 1e-9,
+		},
+		{
+			name:           "upper exponent",
+			expression:     "6.02E23",
+			expectedResult: 6.02e23,
+		},
+		{
+			name:           "explicit plus exponent",
+			expression:     "2e+2-1",
+			expectedResult: 199,
+		},
+		{
+			name:           "hex",
+			expression:     "0xFF",
+			expectedResult: 255,
+		},
+		{
+			name:           "binary",
+			expression:     "0b1010",
+			expectedResult: 10,
+		},
+		{
+			name:        "separators",
+			expression:  "1_000_000+0x_ff",
+			expectedErr: ErrMisplacedSeparator,
+		},
+		{
+			name:           "separators in all forms",
+			expression:     "1_000_000+0xf_f+0b1_0+1_0.5_0e1_0",
+			expectedResult: 1000000 + 255 + 2 + 10.5e10,
+		},
+		{
+			name:           "leading dot",
+			expression:     ".5+.25",
+			expectedResult: 0.75,
+		},
+		{
+			name:           "number before function",
+			expression:     "2exp(0)",
+			expectedResult: 2,
+		},
+		{
+			name:        "missing exponent",
+			expression:  "1e",
+			expectedErr: ErrMalformedExponent,
+		},
+		{
+			name:        "missing exponent digits",
+			expression:  "1e+",
+			expectedErr: ErrMalformedExponent,
+		},
+		{
+			name:        "bad hex digit",
+			expression:  "0xZZ",
+			expectedErr: ErrInvalidDigit,
+		},
+		{
+			name:        "bad binary digit",
+			expression:  "0b102",
+			expectedErr: ErrInvalidDigit,
+		},
+		{
+			name:        "empty hex",
+			expression:  "0x+1",
+			expectedErr: ErrInvalidDigit,
+		},
+		{
+			name:        "trailing separator",
+			expression:  "1_",
+			expectedErr: ErrMisplacedSeparator,
+		},
+		{
+			name:        "double separator",
+			expression:  "1__0",
+			expectedErr: ErrMisplacedSeparator,
+		},
+		{
+			name:        "separator before dot",
+			expression:  "1_.5",
+			expectedErr: ErrMisplacedSeparator,
+		},
+		{
+			name:        "two dots",
+			expression:  "2..2",
+			expectedErr: ErrConvertingToFloat64,
+		},
+	}
+	const EPS = 1e-9
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			val, err := Calc(testCase.expression)
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if math.Abs(val-testCase.expectedResult) > EPS*math.Max(1, math.Abs(testCase.expectedResult)) {
+				t.Fatalf("%g should be equal %g", val, testCase.expectedResult)
+			}
+		})
+	}
+}
+
+func TestEvaluateDecimal(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		precision      uint
+		variables      map[string]float64
+		expectedResult string
+		expectedErr    error
+	}{
+		{
+			name:           "readme example",
+			expression:     "((22.2/2)*3)*(-7)",
+			expectedResult: "-233.1",
+		},
+		{
+			name:           "money",
+			expression:     "0.1+0.2-0.3",
+			expectedResult: "0",
+		},
+		{
+			name:           "long division",
+			expression:     "1/3",
+			precision:      30,
+			expectedResult: "0.333333333333333333333333333333",
+		},
+		{
+			name:           "big power",
+			expression:     "2^100+1",
+			expectedResult: "1267650600228229401496703205377",
+		},
+		{
+			name:           "negative power",
+			expression:     "2^-3",
+			expectedResult: "0.125",
+		},
+		{
+			name:           "literals out of float64 range",
+			expression:     "1e400/1e390 + 1e-400*1e400",
+			expectedResult: "10000000001",
+		},
+		{
+			name:           "variables",
+			expression:     "price*qty",
+			variables:      map[string]float64{"price": 19.99, "qty": 3},
+			expectedResult: "59.97",
+		},
+		{
+			name:           "integer division and modulo",
+			expression:     "-7//2 + 7.5%2",
+			expectedResult: "-2.5",
+		},
+		{
+			name:           "functions",
+			expression:     "sqrt(2)^2 + round(-2.5) + max(1, 0.5) + avg(1, 2)",
+			expectedResult: "1.5",
+		},
+		{
+			name:           "pi",
+			expression:     "pi",
+			precision:      20,
+			expectedResult: "3.1415926535897932385",
+		},
+		{
+			name:           "pi beyond 100 digits",
+			expression:     "pi/3",
+			precision:      200,
+			expectedResult: "1.0471975511965977461542144610931676280657231331250352736583148641026054687620696662093449417807056893273826955044274355490312815365168607439084531360428270391500947009006461737018532148743163183101273",
+		},
+		{
+			name:           "e beyond 100 digits",
+			expression:     "e",
+			precision:      200,
+			expectedResult: "2.718281828459045235360287471352662497757247093699959574966967627724076630353547594571382178525166427427466391932003059921817413596629043572900334295260595630738132328627943490763233829880753195251019",
+		},
+		{
+			name:        "division by zero",
+			expression:  "1/(0.1-0.1)",
+			expectedErr: ErrDivisionByZero,
+		},
+		{
+			name:        "fractional power",
+			expression:  "2^0.5",
+			expectedErr: ErrUnsupportedInMode,
+		},
+		{
+			name:        "transcendental function",
+			expression:  "sin(1)",
+			expectedErr: ErrUnsupportedInMode,
+		},
+		{
+			name:        "precision out of range",
+			expression:  "1",
+			precision:   MaxPrecision + 1,
+			expectedErr: ErrInvalidPrecision,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := Evaluate(testCase.expression, Options{
+				Mode:      ModeDecimal,
+				Precision: testCase.precision,
+				Variables: testCase.variables,
+			})
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if result.String() != testCase.expectedResult {
+				t.Fatalf("%s should be equal %s", result.String(), testCase.expectedResult)
+			}
+		})
+	}
+	if _, err := Evaluate("1", Options{Mode: "octal"}); !errors.Is(err, ErrUnknownMode) {
+		t.Fatalf("unknown mode returns error %v", err)
+	}
+}
+
+func TestEvaluateRational(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		variables      map[string]float64
+		expectedResult string
+		expectedFloat  float64
+		expectedErr    error
+	}{
+		{
+			name:           "sum of fractions",
+			expression:     "1/3+1/6",
+			expectedResult: "1/2",
+			expectedFloat:  0.5,
+		},
+		{
+			name:           "integer",
+			expression:     "2/3*3",
+			expectedResult: "2",
+			expectedFloat:  2,
+		},
+		{
+			name:           "decimal literals",
+			expression:     "0.1+0.2",
+			expectedResult: "3/10",
+			expectedFloat:  0.3,
+		},
+		{
+			name:           "negative power",
+			expression:     "(2/3)^-2",
+			expectedResult: "9/4",
+			expectedFloat:  2.25,
+		},
+		{
+			name:           "perfect square root",
+			expression:     "sqrt(4/9)",
+			expectedResult: "2/3",
+			expectedFloat:  2.0 / 3,
+		},
+		{
+			name:           "variables",
+			expression:     "x/3",
+			variables:      map[string]float64{"x": 0.5},
+			expectedResult: "1/6",
+			expectedFloat:  1.0 / 6,
+		},
+		{
+			name:           "literals out of float64 range",
+			expression:     "1e400/1e399 + 0x1_0000_0000_0000_0000",
+			expectedResult: "18446744073709551626",
+			expectedFloat:  18446744073709551626,
+		},
+		{
+			name:           "modulo and floor",
+			expression:     "7/2%1 + floor(-1/3)",
+			expectedResult: "-1/2",
+			expectedFloat:  -0.5,
+		},
+		{
+			name:        "irrational root",
+			expression:  "sqrt(2)",
+			expectedErr: ErrIrrational,
+		},
+		{
+			name:        "irrational constant",
+			expression:  "2pi",
+			expectedErr: ErrIrrational,
+		},
+		{
+			name:        "irrational function",
+			expression:  "ln(2)",
+			expectedErr: ErrIrrational,
+		},
+		{
+			name:        "fractional power",
+			expression:  "4^(1/2)",
+			expectedErr: ErrIrrational,
+		},
+		{
+			name:        "division by zero",
+			expression:  "1/(1/2-1/2)",
+			expectedErr: ErrDivisionByZero,
+		},
+		{
+			name:        "infinite variable",
+			expression:  "x+1",
+			variables:   map[string]float64{"x": math.Inf(1)},
+			expectedErr: ErrConvertingToFloat64,
+		},
+		{
+			name:        "NaN variable",
+			expression:  "x+1",
+			variables:   map[string]float64{"x": math.NaN()},
+			expectedErr: ErrConvertingToFloat64,
+		},
+	}
+	const EPS = 1e-9
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := Evaluate(testCase.expression, Options{Mode: ModeRational, Variables: testCase.variables})
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if result.String() != testCase.expectedResult {
+				t.Fatalf("%s should be equal %s", result.String(), testCase.expectedResult)
+			}
+			if math.Abs(result.Float-testCase.expectedFloat) > EPS {
+				t.Fatalf("%f should be equal %f", result.Float, testCase.expectedFloat)
+			}
+		})
+	}
+}
+
+func TestFloorModulo(t *testing.T) {
+	operands := [][2]string{{"7", "2"}, {"-7", "2"}, {"7", "-2"}, {"-7", "-2"}, {"6", "-3"}, {"7.5", "-2"}, {"-7.5", "0.5"}}
+	modes := []Mode{ModeFloat, ModeDecimal, ModeRational, ModeComplex, ModeInteger}
+	for _, mode := range modes {
+		for _, operand := range operands {
+			a, b := operand[0], operand[1]
+			if mode == ModeInteger && strings.Contains(a+b, ".") {
+				continue
+			}
+			expression := fmt.Sprintf("((%s)//(%s))*(%s) + (%s)%%(%s) == %s", a, b, b, a, b, a)
+			result, err := Evaluate(expression, Options{Mode: mode})
+			if err != nil || result.Float != 1 {
+				t.Fatalf("%s in %s mode: got %v, error %v", expression, mode, result.Float, err)
+			}
+		}
+	}
+	result, err := Evaluate("-7 % 2", Options{Mode: ModeInteger})
+	if err != nil || result.String() != "1" {
+		t.Fatalf("-7 %% 2 is %s, error %v want 1", result.String(), err)
+	}
+}
+
+func TestEvaluateComplex(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		variables      map[string]float64
+		expectedResult complex128
+		expectedErr    error
+	}{
+		{
+			name:           "square root of negative",
+			expression:     "sqrt(-4)",
+			expectedResult: 2i,
+		},
+		{
+			name:           "product",
+			expression:     "(3+4i)*(1-2i)",
+			expectedResult: 11 - 2i,
+		},
+		{
+			name:           "imaginary unit",
+			expression:     "i^2",
+			expectedResult: -1,
+		},
+		{
+			name:           "euler identity",
+			expression:     "e^(i*pi)+1",
+			expectedResult: 0,
+		},
+		{
+			name:           "division",
+			expression:     "(1+i)/(1-i)",
+			expectedResult: 1i,
+		},
+		{
+			name:           "functions",
+			expression:     "abs(3+4i) + re(2-i) + im(2-i) + conj(i)",
+			expectedResult: 6 - 1i,
+		},
+		{
+			name:           "variables",
+			expression:     "x*i",
+			variables:      map[string]float64{"x": 2},
+			expectedResult: 2i,
+		},
+		{
+			name:           "real only operators",
+			expression:     "7//2 + 7%2 + floor(1.5)",
+			expectedResult: 5,
+		},
+		{
+			name:        "complex zero",
+			expression:  "1/(i-i)",
+			expectedErr: ErrDivisionByZero,
+		},
+		{
+			name:        "complex modulo",
+			expression:  "(1+i)%2",
+			expectedErr: ErrUnsupportedInMode,
+		},
+		{
+			name:        "zero to negative power",
+			expression:  "0^(-1+i)",
+			expectedErr: ErrInvalidPower,
+		},
+		{
+			name:        "reserved unit",
+			expression:  "i",
+			variables:   map[string]float64{"i": 1},
+			expectedErr: ErrReservedName,
+		},
+	}
+	const EPS = 1e-9
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := Evaluate(testCase.expression, Options{Mode: ModeComplex, Variables: testCase.variables})
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if cmplx.Abs(result.Complex-testCase.expectedResult) > EPS {
+				t.Fatalf("%v should be equal %v", result.Complex, testCase.expectedResult)
+			}
+		})
+	}
+	for _, expression := range []string{"4i", "sqrt(-4)", "i"} {
+		if _, err := Calc(expression); err == nil {
+			t.Fatalf("bad case %s don't return error in float mode", expression)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		variables      map[string]float64
+		expectedResult float64
+		expectedTree   string
+		boolean        bool
+	}{
+		{
+			name:           "pricing rule",
+			expression:     "x > 10 && y <= 3 ? 1.5 : 1",
+			variables:      map[string]float64{"x": 11, "y": 3},
+			expectedResult: 1.5,
+			expectedTree:   "(((x > 10) && (y <= 3)) ? 1.5 : 1)",
+		},
+		{
+			name:           "pricing rule else",
+			expression:     "x > 10 && y <= 3 ? 1.5 : 1",
+			variables:      map[string]float64{"x": 10, "y": 3},
+			expectedResult: 1,
+			expectedTree:   "(((x > 10) && (y <= 3)) ? 1.5 : 1)",
+		},
+		{
+			name:           "comparison below arithmetic",
+			expression:     "1+1 == 2",
+			expectedResult: 1,
+			expectedTree:   "((1 + 1) == 2)",
+			boolean:        true,
+		},
+		{
+			name:           "and above or",
+			expression:     "1 || 0 && 0",
+			expectedResult: 1,
+			expectedTree:   "(1 || (0 && 0))",
+			boolean:        true,
+		},
+		{
+			name:           "not",
+			expression:     "!(2 < 1) != 0",
+			expectedResult: 1,
+			expectedTree:   "((!((2 < 1))) != 0)",
+			boolean:        true,
+		},
+		{
+			name:           "nested ternary",
+			expression:     "0 ? 1 : 0 ? 2 : 3",
+			expectedResult: 3,
+			expectedTree:   "(0 ? 1 : (0 ? 2 : 3))",
+		},
+		{
+			name:           "ternary in then branch",
+			expression:     "1 ? 0 ? 2 : 3 : 4",
+			expectedResult: 3,
+			expectedTree:   "(1 ? (0 ? 2 : 3) : 4)",
+		},
+		{
+			name:           "boolean ternary",
+			expression:     "(1 ? 2 > 1 : !1)",
+			expectedResult: 1,
+			expectedTree:   "((1 ? (2 > 1) : (!1)))",
+			boolean:        true,
+		},
+		{
+			name:           "and short circuit",
+			expression:     "0 && 1/0",
+			expectedResult: 0,
+			expectedTree:   "(0 && (1 / 0))",
+			boolean:        true,
+		},
+		{
+			name:           "or short circuit",
+			expression:     "2 || unbound",
+			expectedResult: 1,
+			expectedTree:   "(2 || unbound)",
+			boolean:        true,
+		},
+		{
+			name:           "ternary short circuit",
+			expression:     "1 >= 1 ? 5 : sqrt(-1)",
+			expectedResult: 5,
+			expectedTree:   "((1 >= 1) ? 5 : sqrt((-1)))",
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			node, err := Parse(testCase.expression)
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if node.String() != testCase.expectedTree {
+				t.Fatalf("%s parsed as %s want %s", testCase.expression, node.String(), testCase.expectedTree)
+			}
+			result, err := Evaluate(testCase.expression, Options{Variables: testCase.variables})
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if result.Float != testCase.expectedResult || result.Boolean != testCase.boolean {
+				t.Fatalf("%s: got %v (boolean %v) want %v (boolean %v)", testCase.expression,
+					result.Float, result.Boolean, testCase.expectedResult, testCase.boolean)
+			}
+		})
+	}
+	for _, expression := range []string{"1 ? 2", "1 ? 2 : ", "1 : 2", "2 & 3", "2 | 3", "2 = 3", "1 < < 2"} {
+		if _, err := Calc(expression); err == nil {
+			t.Fatalf("bad case %s don't return error", expression)
+		}
+	}
+	result, err := Evaluate("(1+i)*(1-i) == 2 && i != 1", Options{Mode: ModeComplex})
+	if err != nil || result.Float != 1 {
+		t.Fatalf("complex comparison returns %v, %v", result.Float, err)
+	}
+	result, err = Evaluate("1/3 + 1/6 == 1/2", Options{Mode: ModeRational})
+	if err != nil || result.String() != "1" {
+		t.Fatalf("rational comparison returns %v, %v", result.String(), err)
+	}
+}
+
+func TestEvaluateInteger(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		unsigned       bool
+		variables      map[string]float64
+		expectedResult string
+		expectedErr    error
+	}{
+		{
+			name:           "firmware mask",
+			expression:     "0xFF & (1 << 4) | 3",
+			expectedResult: "19",
+		},
+		{
+			name:           "xor",
+			expression:     "0b1100 xor 0b1010",
+			expectedResult: "6",
+		},
+		{
+			name:           "leading zero is decimal",
+			expression:     "010 + 09",
+			expectedResult: "19",
+		},
+		{
+			name:           "shift below addition",
+			expression:     "1 << 2 + 1",
+			expectedResult: "8",
+		},
+		{
+			name:           "not signed",
+			expression:     "~0",
+			expectedResult: "-1",
+		},
+		{
+			name:           "not unsigned",
+			expression:     "~0",
+			unsigned:       true,
+			expectedResult: "18446744073709551615",
+		},
+		{
+			name:           "arithmetic shift",
+			expression:     "-16 >> 2",
+			expectedResult: "-4",
+		},
+		{
+			name:           "truncated and floored division",
+			expression:     "-7/2*10 + (-7)//2",
+			expectedResult: "-34",
+		},
+		{
+			name:           "exact big values",
+			expression:     "9007199254740993 + 0",
+			expectedResult: "9007199254740993",
+		},
+		{
+			name:           "max signed",
+			expression:     "2^62 - 1 + 2^62",
+			expectedResult: "9223372036854775807",
+		},
+		{
+			name:           "variables",
+			expression:     "flags & mask",
+			variables:      map[string]float64{"flags": 13, "mask": 4},
+			expectedResult: "4",
+		},
+		{
+			name:           "comparison",
+			expression:     "(5 & 4) == 4 ? 10 : 20",
+			expectedResult: "10",
+		},
+		{
+			name:           "smallest literal",
+			expression:     "-9223372036854775808 + 0",
+			expectedResult: "-9223372036854775808",
+		},
+		{
+			name:        "literal below the smallest",
+			expression:  "-9223372036854775809",
+			expectedErr: ErrIntegerOverflow,
+		},
+		{
+			name:        "literal above the largest",
+			expression:  "1 - 9223372036854775808",
+			expectedErr: ErrIntegerOverflow,
+		},
+		{
+			name:        "add overflow",
+			expression:  "9223372036854775807 + 1",
+			expectedErr: ErrIntegerOverflow,
+		},
+		{
+			name:        "literal overflow",
+			expression:  "0x1_0000_0000_0000_0000",
+			unsigned:    true,
+			expectedErr: ErrIntegerOverflow,
+		},
+		{
+			name:        "shift overflow",
+			expression:  "0xFF << 60",
+			unsigned:    true,
+			expectedErr: ErrIntegerOverflow,
+		},
+		{
+			name:        "unsigned negation",
+			expression:  "-1",
+			unsigned:    true,
+			expectedErr: ErrIntegerOverflow,
+		},
+		{
+			name:        "power overflow",
+			expression:  "3^100",
+			expectedErr: ErrIntegerOverflow,
+		},
+		{
+			name:        "shift count",
+			expression:  "1 << 64",
+			expectedErr: ErrInvalidShift,
+		},
+		{
+			name:        "fraction literal",
+			expression:  "1.5 + 1",
+			expectedErr: ErrNotInteger,
+		},
+		{
+			name:        "fraction variable",
+			expression:  "x",
+			variables:   map[string]float64{"x": 0.5},
+			expectedErr: ErrNotInteger,
+		},
+		{
+			name:        "constant",
+			expression:  "pi",
+			expectedErr: ErrNotInteger,
+		},
+		{
+			name:        "division by zero",
+			expression:  "1/0",
+			expectedErr: ErrDivisionByZero,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := Evaluate(testCase.expression, Options{
+				Mode:      ModeInteger,
+				Unsigned:  testCase.unsigned,
+				Variables: testCase.variables,
+			})
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if result.String() != testCase.expectedResult {
+				t.Fatalf("%s should be equal %s", result.String(), testCase.expectedResult)
+			}
+		})
+	}
+	result, _ := Evaluate("-255", Options{Mode: ModeInteger})
+	if result.Text(16) != "-0xff" || result.Text(2) != "-0b11111111" {
+		t.Fatalf("wrong formatting %s %s", result.Text(16), result.Text(2))
+	}
+	if _, err := Calc("6 & 3"); !errors.Is(err, ErrUndefinedOperand) {
+		t.Fatalf("bitwise operator in float mode returns %v", err)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	testCases := []struct {
+		name           string
+		expression     string
+		variables      map[string]float64
+		mode           Mode
+		expectedResult string
+		expectedTree   string
+		expectedErr    error
+	}{
+		{
+			name:           "functions",
+			expression:     "f(x) = x^2 + 1; g(a,b) = f(a) - b; g(3, 2)",
+			expectedResult: "8",
+			expectedTree:   "f(x) = ((x ^ 2) + 1); g(a, b) = (f(a) - b); g(3, 2)",
+		},
+		{
+			name:           "assignments",
+			expression:     "a = 5; b = a * 2; a = a + b; a;",
+			expectedResult: "15",
+			expectedTree:   "a = 5; b = (a * 2); a = (a + b); a",
+		},
+		{
+			name:           "assignment result",
+			expression:     "a = 2 + 3",
+			expectedResult: "5",
+			expectedTree:   "a = (2 + 3)",
+		},
+		{
+			name:           "parameter shadows global",
+			expression:     "x = 10; f(x) = x + y; f(1)",
+			variables:      map[string]float64{"y": 100},
+			expectedResult: "101",
+			expectedTree:   "x = 10; f(x) = (x + y); f(1)",
+		},
+		{
+			name:           "assignment shadows variable",
+			expression:     "y = y * 2; y",
+			variables:      map[string]float64{"y": 4},
+			expectedResult: "8",
+			expectedTree:   "y = (y * 2); y",
+		},
+		{
+			name:           "recursion",
+			expression:     "fact(n) = n <= 1 ? 1 : n * fact(n - 1); fact(5)",
+			expectedResult: "120",
+			expectedTree:   "fact(n) = ((n <= 1) ? 1 : (n * fact((n - 1)))); fact(5)",
+		},
+		{
+			name:           "rational mode",
+			expression:     "h(a, b) = 2/(1/a + 1/b); h(3, 6)",
+			mode:           ModeRational,
+			expectedResult: "4",
+			expectedTree:   "h(a, b) = (2 / (((1 / a) + (1 / b)))); h(3, 6)",
+		},
+		{
+			name:        "infinite recursion",
+			expression:  "f(x) = f(x + 1); f(0)",
+			expectedErr: ErrRecursionDepth,
+		},
+		{
+			name:        "exponential recursion",
+			expression:  "f(n) = n <= 0 ? 1 : f(n-1) + f(n-1); f(60)",
+			expectedErr: ErrTooManySteps,
+		},
+		{
+			name:        "built-in function",
+			expression:  "sqrt(x) = x; 1",
+			expectedErr: ErrReservedName,
+		},
+		{
+			name:        "constant",
+			expression:  "pi = 3",
+			expectedErr: ErrReservedName,
+		},
+		{
+			name:        "constant parameter",
+			expression:  "f(e) = e; f(1)",
+			expectedErr: ErrReservedName,
+		},
+		{
+			name:        "imaginary unit",
+			expression:  "i = 2; i",
+			mode:        ModeComplex,
+			expectedErr: ErrReservedName,
+		},
+		{
+			name:        "invalid target",
+			expression:  "1 + a = 2",
+			expectedErr: ErrInvalidDefinition,
+		},
+		{
+			name:        "invalid parameter",
+			expression:  "f(x + 1) = x",
+			expectedErr: ErrInvalidDefinition,
+		},
+		{
+			name:        "duplicate parameter",
+			expression:  "f(x, x) = x",
+			expectedErr: ErrInvalidDefinition,
+		},
+		{
+			name:        "wrong arity",
+			expression:  "f(x) = x; f(1, 2)",
+			expectedErr: ErrTooManyArguments,
+		},
+		{
+			name:        "definition only",
+			expression:  "f(x) = x",
+			expectedErr: ErrNoResult,
+		},
+		{
+			name:        "empty statement",
+			expression:  "1;;2",
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "chained assignment",
+			expression:  "a = b = 1",
+			expectedErr: ErrInvalidExpression,
+		},
+		{
+			name:        "parameter outside of function",
+			expression:  "f(x) = x; f(1) + x",
+			expectedErr: ErrUnboundIdentifier,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := Evaluate(testCase.expression, Options{Mode: testCase.mode, Variables: testCase.variables})
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: got error %v want %v", testCase.expression, err, testCase.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("successful case %s returns error %v", testCase.expression, err)
+			}
+			if result.String() != testCase.expectedResult {
+				t.Fatalf("%s should be equal %s", result.String(), testCase.expectedResult)
+			}
+			node, _ := Parse(testCase.expression)
+			if node.String() != testCase.expectedTree {
+				t.Fatalf("%s parsed as %s want %s", testCase.expression, node.String(), testCase.expectedTree)
+			}
+		})
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	testCases := []struct {
+		expression string
+		mode       Mode
+		position   int
+	}{
+		{"10^400", ModeFloat, 2},
+		{"1e308*10", ModeFloat, 5},
+		{"1 + (-1e308 - 1e308)", ModeFloat, 12},
+		{"1e300 / 1e-300", ModeFloat, 6},
+		{"1e308 // 0.1", ModeFloat, 6},
+		{"10^400", ModeComplex, 2},
+		{"1e308i * 10", ModeComplex, 7},
+		{"(2^100000)^100000", ModeDecimal, 10},
+		{"(2^100000)^100000", ModeRational, 10},
+		{"(1/2^100000)^-100000", ModeRational, 12},
+		{"f(x)=x*x; f(f(f(f(f(f(f(3^100000)))))))", ModeRational, 6},
+		{"f(x)=x*x; f(f(f(f(f(f(f(3^100000)))))))", ModeDecimal, 6},
+		{"a=3^100000; a=a*a; a=a*a; a=a*a; a=a*a; a=a*a; a*a", ModeRational, 43},
+	}
+	for _, testCase := range testCases {
+		_, err := Evaluate(testCase.expression, Options{Mode: testCase.mode})
+		var syntaxErr *SyntaxError
+		if !errors.Is(err, ErrOverflow) || !errors.As(err, &syntaxErr) || syntaxErr.Position != testCase.position {
+			t.Fatalf("%s in %s mode: got error %v want %v at %d", testCase.expression, testCase.mode, err, ErrOverflow, testCase.position)
+		}
+		if testCase.mode != ModeFloat {
+			continue
+		}
+		program, err := Compile(testCase.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := program.Eval(nil); !errors.Is(err, ErrOverflow) {
+			t.Fatalf("%s: program got error %v want %v", testCase.expression, err, ErrOverflow)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	variables := map[string]float64{"x": 3, "y": -0.5}
+	expressions := []string{
+		"2+2*2",
+		"x*2+y",
+		"-x^2 + (--y)",
+		"2x(x+1)pi",
+		"sqrt(16) + max(x, y, 7) - hypot(3, 4)",
+		"x > 2 && y < 0 ? sum(1, 2, 3) : avg(4)",
+		"0 && 1/0",
+		"1 || 1/0",
+		"!(x == 3) || !y",
+		"x != 3 ? 1/0 : 7 // 2 % 3",
+		"(x >= 3) + (y <= -1)",
+		"1/(x-3)",
+		"0^-1",
+		"x % 0",
+		"ln(y)",
+		"2 & 3",
+		"~x",
+		"2i",
+		"z + 1",
+		"sin(1, 2)",
+		"cot(x)",
+		"y = x * 2; y + 1",
+		"f(a) = a + x; f(1)",
+		"10^400",
+		"x * 1e308 - 1",
+		"1e308 + 1e308",
+		"1e-308 / (1e-300 * x)",
+		"1e400 - 1",
+		"2i + 1e400i",
+	}
+	for _, expression := range expressions {
+		t.Run(expression, func(t *testing.T) {
+			program, err := Compile(expression)
+			if err != nil {
+				t.Fatalf("%s: compile error %v", expression, err)
+			}
+			if tokens, _ := CountTokens(expression); program.Tokens() != tokens {
+				t.Fatalf("%s: program has %d tokens want %d", expression, program.Tokens(), tokens)
+			}
+			node, _ := Parse(expression)
+			expectedResult, expectedErr := EvalWithVariables(node, variables)
+			for i := 0; i < 2; i++ {
+				val, err := program.Eval(variables)
+				if expectedErr != nil {
+					var syntaxErr, expectedSyntaxErr *SyntaxError
+					if err == nil || err.Error() != expectedErr.Error() {
+						t.Fatalf("%s: got error %v want %v", expression, err, expectedErr)
+					}
+					if errors.As(expectedErr, &expectedSyntaxErr) && (!errors.As(err, &syntaxErr) || syntaxErr.Position != expectedSyntaxErr.Position) {
+						t.Fatalf("%s: error %v reported at wrong position", expression, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("successful case %s returns error %v", expression, err)
+				}
+				if val != expectedResult {
+					t.Fatalf("%f should be equal %f", val, expectedResult)
+				}
+			}
+			if program.Boolean() != IsBoolean(node) {
+				t.Fatalf("%s: wrong boolean flag", expression)
+			}
+		})
+	}
+	if _, err := Compile("2+"); !errors.Is(err, ErrInvalidExpression) {
+		t.Fatalf("got error %v want %v", err, ErrInvalidExpression)
+	}
+	program, _ := Compile("pi")
+	if _, err := program.Eval(map[string]float64{"pi": 3}); !errors.Is(err, ErrReservedName) {
+		t.Fatalf("got error %v want %v", err, ErrReservedName)
+	}
+}
+
+func TestProgramAllocations(t *testing.T) {
+	program, err := Compile("x > 0 ? sqrt(x^2 + y^2) * sin(pi/4) : max(x, y, 1) - 2y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	variables := map[string]float64{"x": 3, "y": 4}
+	allocations := testing.AllocsPerRun(100, func() {
+		program.Eval(variables)
+	})
+	if allocations != 0 {
+		t.Fatalf("Eval allocates %v times per run", allocations)
+	}
+}
+
+const benchmarkExpression = "x > 0 ? sqrt(x^2 + y^2) * sin(pi/4) : max(x, y, 1) - 2y"
+
+func BenchmarkCalcWithVariables(b *testing.B) {
+	variables := map[string]float64{"x": 3, "y": 4}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := CalcWithVariables(benchmarkExpression, variables); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEvalWithVariables(b *testing.B) {
+	node, _ := Parse(benchmarkExpression)
+	variables := map[string]float64{"x": 3, "y": 4}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := EvalWithVariables(node, variables); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramEval(b *testing.B) {
+	program, _ := Compile(benchmarkExpression)
+	variables := map[string]float64{"x": 3, "y": 4}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := program.Eval(variables); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramEvalParallel(b *testing.B) {
+	program, _ := Compile(benchmarkExpression)
+	variables := map[string]float64{"x": 3, "y": 4}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := program.Eval(variables); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,372 @@
+package calculator
+
+import (
+	"math"
+	"sync"
+)
+
+type opcode uint8
+
+const (
+	opConst opcode = iota
+	opLoad
+	opNumber
+	opNeg
+	opNot
+	opUnary
+	opAdd
+	opSub
+	opMul
+	opDiv
+	opPow
+	opEq
+	opNe
+	opLt
+	opLe
+	opGt
+	opGe
+	opBinary
+	opTruth
+	opJump
+	opJumpIfFalse
+	opJumpIfTrue
+	opCall
+	opFail
+)
+
+var binaryOpcodes = map[string]opcode{
+	"+":  opAdd,
+	"-":  opSub,
+	"*":  opMul,
+	"/":  opDiv,
+	"^":  opPow,
+	"==": opEq,
+	"!=": opNe,
+	"<":  opLt,
+	"<=": opLe,
+	">":  opGt,
+	">=": opGe,
+}
+
+type instruction struct {
+	op  opcode
+	arg int32
+}
+
+// Program is an expression compiled for repeated evaluation in float mode.
+// It is safe for concurrent use.
+type Program struct {
+	code []instruction
+	// nodes[i] is the node code[i] was compiled from, used to report errors.
+	nodes     []Node
+	constants []float64
+	names     []string
+	functions []*Function
+	maxStack  int
+	boolean   bool
+	tokens    int
+	// tree is set instead of code for expressions with assignments and
+	// function definitions, which are evaluated by walking the tree.
+	tree   Node
+	stacks sync.Pool
+}
+
+type compiler struct {
+	program *Program
+	depth   int
+}
+
+// Compile parses expression into a Program.
+func Compile(expression string) (*Program, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	node, err := parseTokens(tokens)
+	if err != nil {
+		return nil, err
+	}
+	program := &Program{boolean: IsBoolean(node), tokens: len(tokens) - 1}
+	switch node.(type) {
+	case *Sequence, *Assignment, *FunctionDef:
+		program.tree = node
+		return program, nil
+	}
+	c := compiler{program: program}
+	c.compile(node)
+	program.stacks.New = func() any {
+		stack := make([]float64, program.maxStack)
+		return &stack
+	}
+	return program, nil
+}
+
+// Boolean reports whether the program computes a comparison or a logical
+// operator.
+func (p *Program) Boolean() bool {
+	return p.boolean
+}
+
+// Tokens returns the number of tokens of the compiled expression, as
+// CountTokens does.
+func (p *Program) Tokens() int {
+	return p.tokens
+}
+
+func (c *compiler) emit(op opcode, arg int, node Node, effect int) int {
+	c.program.code = append(c.program.code, instruction{op: op, arg: int32(arg)})
+	c.program.nodes = append(c.program.nodes, node)
+	c.depth += effect
+	if c.depth > c.program.maxStack {
+		c.program.maxStack = c.depth
+	}
+	return len(c.program.code) - 1
+}
+
+// patch points the jump at index to the next instruction.
+func (c *compiler) patch(index int) {
+	c.program.code[index].arg = int32(len(c.program.code))
+}
+
+func (c *compiler) constant(node Node, value float64) {
+	for i, existing := range c.program.constants {
+		if existing == value && math.Signbit(existing) == math.Signbit(value) {
+			c.emit(opConst, i, node, 1)
+			return
+		}
+	}
+	c.program.constants = append(c.program.constants, value)
+	c.emit(opConst, len(c.program.constants)-1, node, 1)
+}
+
+func (c *compiler) name(name string) int {
+	for i, existing := range c.program.names {
+		if existing == name {
+			return i
+		}
+	}
+	c.program.names = append(c.program.names, name)
+	return len(c.program.names) - 1
+}
+
+func (c *compiler) function(function *Function) int {
+	for i, existing := range c.program.functions {
+		if existing == function {
+			return i
+		}
+	}
+	c.program.functions = append(c.program.functions, function)
+	return len(c.program.functions) - 1
+}
+
+func (c *compiler) compile(node Node) {
+	switch n := node.(type) {
+	case *Number:
+		// Imaginary and out of range numbers fail when they are evaluated.
+		if n.Imaginary || math.IsInf(n.Value, 0) {
+			c.emit(opNumber, 0, n, 1)
+			return
+		}
+		c.constant(n, n.Value)
+	case *Identifier:
+		if value, ok := constants[n.Name]; ok {
+			c.constant(n, value)
+			return
+		}
+		c.emit(opLoad, c.name(n.Name), n, 1)
+	case *Group:
+		c.compile(n.Inner)
+	case *UnaryOp:
+		c.compile(n.Operand)
+		switch n.Op {
+		case "+":
+		case "-":
+			c.emit(opNeg, 0, n, 0)
+		case "!":
+			c.emit(opNot, 0, n, 0)
+		default:
+			c.emit(opUnary, 0, n, 0)
+		}
+	case *Conditional:
+		c.compile(n.Condition)
+		otherwise := c.emit(opJumpIfFalse, 0, n, -1)
+		c.compile(n.Then)
+		end := c.emit(opJump, 0, n, 0)
+		c.patch(otherwise)
+		c.depth--
+		c.compile(n.Else)
+		c.patch(end)
+	case *BinaryOp:
+		c.compile(n.Left)
+		switch n.Op {
+		case "&&", "||":
+			jump := opJumpIfFalse
+			decided := 0.0
+			if n.Op == "||" {
+				jump, decided = opJumpIfTrue, 1
+			}
+			short := c.emit(jump, 0, n, -1)
+			c.compile(n.Right)
+			c.emit(opTruth, 0, n, 0)
+			end := c.emit(opJump, 0, n, 0)
+			c.patch(short)
+			c.depth--
+			c.constant(n, decided)
+			c.patch(end)
+			return
+		}
+		c.compile(n.Right)
+		op, ok := binaryOpcodes[n.Op]
+		if !ok {
+			op = opBinary
+		}
+		c.emit(op, 0, n, -1)
+	case *Call:
+		function, ok := functions[n.Name]
+		if !ok || function.checkArity(n) != nil {
+			// The call fails before its arguments are evaluated.
+			c.emit(opFail, 0, n, 1)
+			return
+		}
+		for _, arg := range n.Args {
+			c.compile(arg)
+		}
+		c.emit(opCall, c.function(function), n, 1-len(n.Args))
+	default:
+		c.emit(opFail, 0, n, 1)
+	}
+}
+
+// Eval computes the program with the given variables. Apart from errors it
+// does not allocate.
+func (p *Program) Eval(variables map[string]float64) (float64, error) {
+	if p.tree != nil {
+		return EvalWithVariables(p.tree, variables)
+	}
+	if err := checkVariables(variables, isBuiltinConstant); err != nil {
+		return 0, err
+	}
+	pooled := p.stacks.Get().(*[]float64)
+	defer p.stacks.Put(pooled)
+	return p.run(*pooled, variables)
+}
+
+func (p *Program) run(stack []float64, variables map[string]float64) (float64, error) {
+	arith := floatArithmetic{}
+	sp := 0
+	for pc := 0; pc < len(p.code); pc++ {
+		instruction := p.code[pc]
+		switch instruction.op {
+		case opConst:
+			stack[sp] = p.constants[instruction.arg]
+			sp++
+		case opLoad:
+			value, ok := variables[p.names[instruction.arg]]
+			if !ok {
+				return 0, p.fail(pc)
+			}
+			stack[sp] = value
+			sp++
+		case opNumber:
+			value, err := arith.number(p.nodes[pc].(*Number))
+			if err != nil {
+				return 0, err
+			}
+			stack[sp] = value
+			sp++
+		case opNeg:
+			stack[sp-1] = -stack[sp-1]
+		case opNot:
+			stack[sp-1] = arith.boolean(stack[sp-1] == 0)
+		case opUnary:
+			value, err := arith.unary(p.nodes[pc].(*UnaryOp), stack[sp-1])
+			if err != nil {
+				return 0, err
+			}
+			stack[sp-1] = value
+		case opTruth:
+			stack[sp-1] = arith.boolean(stack[sp-1] != 0)
+		case opJump:
+			pc = int(instruction.arg) - 1
+		case opJumpIfFalse:
+			sp--
+			if stack[sp] == 0 {
+				pc = int(instruction.arg) - 1
+			}
+		case opJumpIfTrue:
+			sp--
+			if stack[sp] != 0 {
+				pc = int(instruction.arg) - 1
+			}
+		case opCall:
+			function := p.functions[instruction.arg]
+			args := len(p.nodes[pc].(*Call).Args)
+			value, err := arith.call(p.nodes[pc].(*Call), function, stack[sp-args:sp])
+			if err != nil {
+				return 0, err
+			}
+			sp -= args
+			stack[sp] = value
+			sp++
+		case opFail:
+			return 0, p.fail(pc)
+		default:
+			sp--
+			left, right := stack[sp-1], stack[sp]
+			switch instruction.op {
+			case opAdd:
+				stack[sp-1] = left + right
+			case opSub:
+				stack[sp-1] = left - right
+			case opMul:
+				stack[sp-1] = left * right
+			case opDiv:
+				if right == 0 {
+					return 0, newSyntaxError(ErrDivisionByZero, p.nodes[pc].Pos(), "/")
+				}
+				stack[sp-1] = left / right
+			case opEq:
+				stack[sp-1] = arith.boolean(left == right)
+			case opNe:
+				stack[sp-1] = arith.boolean(left != right)
+			case opLt:
+				stack[sp-1] = arith.boolean(left < right)
+			case opLe:
+				stack[sp-1] = arith.boolean(left <= right)
+			case opGt:
+				stack[sp-1] = arith.boolean(left > right)
+			case opGe:
+				stack[sp-1] = arith.boolean(left >= right)
+			default:
+				value, err := arith.binary(p.nodes[pc].(*BinaryOp), left, right)
+				if err != nil {
+					return 0, err
+				}
+				stack[sp-1] = value
+			}
+			if math.IsInf(stack[sp-1], 0) {
+				return 0, newSyntaxError(ErrOverflow, p.nodes[pc].Pos(), p.nodes[pc].(*BinaryOp).Op)
+			}
+		}
+	}
+	return stack[0], nil
+}
+
+// fail builds the error the tree evaluator reports for the node code[pc]
+// was compiled from.
+func (p *Program) fail(pc int) error {
+	switch n := p.nodes[pc].(type) {
+	case *Identifier:
+		return unboundIdentifier(n)
+	case *Call:
+		function, ok := functions[n.Name]
+		if !ok {
+			return newSyntaxError(ErrUnknownFunction, n.Position, n.Name)
+		}
+		if err := function.checkArity(n); err != nil {
+			return err
+		}
+	}
+	node := p.nodes[pc]
+	return newSyntaxError(ErrInvalidExpression, node.Pos(), node.String())
+}
@@ -0,0 +1,166 @@
+package calculator
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+const imaginaryUnit = "i"
+
+var complexFunctions = map[string]func(args []complex128) complex128{
+	"sin":  func(args []complex128) complex128 { return cmplx.Sin(args[0]) },
+	"cos":  func(args []complex128) complex128 { return cmplx.Cos(args[0]) },
+	"tan":  func(args []complex128) complex128 { return cmplx.Tan(args[0]) },
+	"asin": func(args []complex128) complex128 { return cmplx.Asin(args[0]) },
+	"acos": func(args []complex128) complex128 { return cmplx.Acos(args[0]) },
+	"atan": func(args []complex128) complex128 { return cmplx.Atan(args[0]) },
+	"sinh": func(args []complex128) complex128 { return cmplx.Sinh(args[0]) },
+	"cosh": func(args []complex128) complex128 { return cmplx.Cosh(args[0]) },
+	"tanh": func(args []complex128) complex128 { return cmplx.Tanh(args[0]) },
+	"sqrt": func(args []complex128) complex128 { return cmplx.Sqrt(args[0]) },
+	"exp":  func(args []complex128) complex128 { return cmplx.Exp(args[0]) },
+	"ln":   func(args []complex128) complex128 { return cmplx.Log(args[0]) },
+	"log2": func(args []complex128) complex128 { return cmplx.Log(args[0]) / math.Ln2 },
+	"abs":  func(args []complex128) complex128 { return complex(cmplx.Abs(args[0]), 0) },
+	"pow":  func(args []complex128) complex128 { return cmplx.Pow(args[0], args[1]) },
+	"re":   func(args []complex128) complex128 { return complex(real(args[0]), 0) },
+	"im":   func(args []complex128) complex128 { return complex(imag(args[0]), 0) },
+	"conj": func(args []complex128) complex128 { return cmplx.Conj(args[0]) },
+	"arg":  func(args []complex128) complex128 { return complex(cmplx.Phase(args[0]), 0) },
+	"log": func(args []complex128) complex128 {
+		if len(args) == 2 {
+			return cmplx.Log(args[0]) / cmplx.Log(args[1])
+		}
+		return cmplx.Log10(args[0])
+	},
+	"sum": func(args []complex128) complex128 {
+		var result complex128
+		for _, arg := range args {
+			result += arg
+		}
+		return result
+	},
+	"avg": func(args []complex128) complex128 {
+		var result complex128
+		for _, arg := range args {
+			result += arg
+		}
+		return result / complex(float64(len(args)), 0)
+	},
+}
+
+type complexArithmetic struct{}
+
+func isReal(x complex128) bool {
+	return imag(x) == 0
+}
+
+func isFinite(x complex128) bool {
+	return !cmplx.IsNaN(x) && !cmplx.IsInf(x)
+}
+
+func (complexArithmetic) number(n *Number) (complex128, error) {
+	if math.IsInf(n.Value, 0) {
+		return 0, newSyntaxError(ErrConvertingToFloat64, n.Position, n.String(), tokenNumber.String())
+	}
+	if n.Imaginary {
+		return complex(0, n.Value), nil
+	}
+	return complex(n.Value, 0), nil
+}
+
+func (complexArithmetic) isConstant(name string) bool {
+	return name == imaginaryUnit || isBuiltinConstant(name)
+}
+
+func (complexArithmetic) constant(n *Identifier) (complex128, error) {
+	if n.Name == imaginaryUnit {
+		return complex(0, 1), nil
+	}
+	return complex(constants[n.Name], 0), nil
+}
+
+func (complexArithmetic) variable(n *Identifier, value float64) (complex128, error) {
+	return complex(value, 0), nil
+}
+
+func (complexArithmetic) unary(n *UnaryOp, x complex128) (complex128, error) {
+	switch n.Op {
+	case "+":
+		return x, nil
+	case "-":
+		// Adding zero drops the sign of a zero part: -(4+0i) must be
+		// -4+0i, or sqrt(-4) would land on the other side of the branch cut.
+		return -x + 0, nil
+	}
+	return 0, newSyntaxError(ErrUndefinedOperand, n.Position, n.Op)
+}
+
+func (complexArithmetic) binary(n *BinaryOp, left, right complex128) (complex128, error) {
+	var result complex128
+	switch n.Op {
+	case "+":
+		result = left + right
+	case "-":
+		result = left - right
+	case "*":
+		result = left * right
+	case "/":
+		if right == 0 {
+			return 0, newSyntaxError(ErrDivisionByZero, n.Position, n.Op)
+		}
+		result = left / right
+	case "==":
+		return complexArithmetic{}.boolean(left == right), nil
+	case "!=":
+		return complexArithmetic{}.boolean(left != right), nil
+	case "^":
+		if left == 0 && (real(right) < 0 || !isReal(right)) {
+			return 0, newSyntaxError(ErrInvalidPower, n.Position, n.Op)
+		}
+		result = cmplx.Pow(left, right)
+	}
+	switch n.Op {
+	case "+", "-", "*", "/", "^":
+		if !isFinite(result) {
+			return 0, newSyntaxError(ErrOverflow, n.Position, n.Op)
+		}
+		return result, nil
+	}
+	// The remaining operators are only defined on the real line.
+	if !isReal(left) || !isReal(right) {
+		return 0, newSyntaxError(ErrUnsupportedInMode, n.Position, n.Op)
+	}
+	real_result, err := floatArithmetic{}.binary(n, real(left), real(right))
+	return complex(real_result, 0), err
+}
+
+func (complexArithmetic) call(n *Call, function *Function, args []complex128) (complex128, error) {
+	if call := complexFunctions[n.Name]; call != nil {
+		result := call(args)
+		if !isFinite(result) {
+			return 0, newSyntaxError(ErrFunctionDomain, n.Position, n.Name)
+		}
+		return result, nil
+	}
+	real_args := make([]float64, len(args))
+	for i, arg := range args {
+		if !isReal(arg) {
+			return 0, newSyntaxError(ErrUnsupportedInMode, n.Position, n.Name)
+		}
+		real_args[i] = real(arg)
+	}
+	result, err := floatArithmetic{}.call(n, function, real_args)
+	return complex(result, 0), err
+}
+
+func (complexArithmetic) truth(x complex128) bool {
+	return x != 0
+}
+
+func (complexArithmetic) boolean(b bool) complex128 {
+	if b {
+		return 1
+	}
+	return 0
+}
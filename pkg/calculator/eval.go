@@ -0,0 +1,270 @@
+package calculator
+
+import (
+	"fmt"
+	"math"
+)
+
+var constants = map[string]float64{
+	"pi":  math.Pi,
+	"e":   math.E,
+	"phi": math.Phi,
+}
+
+// arithmetic is a number system the expression tree can be evaluated in.
+// Every method receives the node it computes so errors can point at it.
+type arithmetic[T any] interface {
+	number(n *Number) (T, error)
+	isConstant(name string) bool
+	constant(n *Identifier) (T, error)
+	variable(n *Identifier, value float64) (T, error)
+	unary(n *UnaryOp, x T) (T, error)
+	binary(n *BinaryOp, x, y T) (T, error)
+	call(n *Call, function *Function, args []T) (T, error)
+	truth(x T) bool
+	boolean(b bool) T
+}
+
+// negativeLiteral is implemented by the number systems that check the
+// range of literals, so that a negated literal is checked after the
+// negation and the smallest value can be written.
+type negativeLiteral[T any] interface {
+	negativeNumber(n *UnaryOp, literal *Number) (T, error)
+}
+
+// MaxCallDepth limits nesting of calls to functions defined in the
+// expression, so runaway recursion fails instead of exhausting the stack.
+const MaxCallDepth = 256
+
+// MaxSteps limits the number of nodes evaluated in one expression, so that
+// functions calling themselves more than once cannot run for ages within
+// MaxCallDepth. Without such functions an expression never comes near it.
+const MaxSteps = 1000000
+
+type evaluator[T any] struct {
+	arith     arithmetic[T]
+	variables map[string]float64
+	assigned  map[string]T
+	defined   map[string]*FunctionDef
+	frame     map[string]T
+	depth     int
+	steps     int
+}
+
+func isBuiltinConstant(name string) bool {
+	_, ok := constants[name]
+	return ok
+}
+
+func checkVariables(variables map[string]float64, isConstant func(string) bool) error {
+	for name := range variables {
+		if isConstant(name) {
+			return fmt.Errorf("%w: %s", ErrReservedName, name)
+		}
+	}
+	return nil
+}
+
+func evaluate[T any](node Node, arith arithmetic[T], variables map[string]float64) (T, error) {
+	if err := checkVariables(variables, arith.isConstant); err != nil {
+		var zero T
+		return zero, err
+	}
+	e := evaluator[T]{
+		arith:     arith,
+		variables: variables,
+		assigned:  make(map[string]T),
+		defined:   make(map[string]*FunctionDef),
+	}
+	return e.eval(node)
+}
+
+// Eval computes the value of an expression tree built by Parse.
+func Eval(node Node) (float64, error) {
+	return EvalWithVariables(node, nil)
+}
+
+// EvalWithVariables is like Eval, but resolves identifiers that are not
+// built-in constants from variables.
+func EvalWithVariables(node Node, variables map[string]float64) (float64, error) {
+	return evaluate[float64](node, floatArithmetic{}, variables)
+}
+
+func (e *evaluator[T]) eval(node Node) (T, error) {
+	var zero T
+	e.steps++
+	switch n := node.(type) {
+	case *Number:
+		return e.arith.number(n)
+	case *Identifier:
+		if value, ok := e.frame[n.Name]; ok {
+			return value, nil
+		}
+		if e.arith.isConstant(n.Name) {
+			return e.arith.constant(n)
+		}
+		if value, ok := e.assigned[n.Name]; ok {
+			return value, nil
+		}
+		if value, ok := e.variables[n.Name]; ok {
+			return e.arith.variable(n, value)
+		}
+		return zero, unboundIdentifier(n)
+	case *Group:
+		return e.eval(n.Inner)
+	case *UnaryOp:
+		if literal, ok := n.Operand.(*Number); ok && n.Op == "-" {
+			if negative, ok := e.arith.(negativeLiteral[T]); ok {
+				return negative.negativeNumber(n, literal)
+			}
+		}
+		value, err := e.eval(n.Operand)
+		if err != nil {
+			return zero, err
+		}
+		if n.Op == "!" {
+			return e.arith.boolean(!e.arith.truth(value)), nil
+		}
+		return e.arith.unary(n, value)
+	case *Conditional:
+		condition, err := e.eval(n.Condition)
+		if err != nil {
+			return zero, err
+		}
+		if e.arith.truth(condition) {
+			return e.eval(n.Then)
+		}
+		return e.eval(n.Else)
+	case *BinaryOp:
+		left, err := e.eval(n.Left)
+		if err != nil {
+			return zero, err
+		}
+		// The right operand of a logical operator is only evaluated when
+		// the left one does not decide the result.
+		switch n.Op {
+		case "&&", "||":
+			if e.arith.truth(left) == (n.Op == "||") {
+				return e.arith.boolean(n.Op == "||"), nil
+			}
+			right, err := e.eval(n.Right)
+			if err != nil {
+				return zero, err
+			}
+			return e.arith.boolean(e.arith.truth(right)), nil
+		}
+		right, err := e.eval(n.Right)
+		if err != nil {
+			return zero, err
+		}
+		return e.arith.binary(n, left, right)
+	case *Sequence:
+		for _, statement := range n.Statements[:len(n.Statements)-1] {
+			if definition, ok := statement.(*FunctionDef); ok {
+				if err := e.define(definition); err != nil {
+					return zero, err
+				}
+				continue
+			}
+			if _, err := e.eval(statement); err != nil {
+				return zero, err
+			}
+		}
+		return e.eval(n.Statements[len(n.Statements)-1])
+	case *Assignment:
+		if err := e.checkName(n.Name, n.Position); err != nil {
+			return zero, err
+		}
+		value, err := e.eval(n.Value)
+		if err != nil {
+			return zero, err
+		}
+		e.assigned[n.Name] = value
+		return value, nil
+	case *FunctionDef:
+		if err := e.define(n); err != nil {
+			return zero, err
+		}
+		return zero, newSyntaxError(ErrNoResult, n.Position, n.Name)
+	case *Call:
+		if definition, ok := e.defined[n.Name]; ok {
+			return e.callDefined(n, definition)
+		}
+		function, ok := functions[n.Name]
+		if !ok {
+			return zero, newSyntaxError(ErrUnknownFunction, n.Position, n.Name)
+		}
+		if err := function.checkArity(n); err != nil {
+			return zero, err
+		}
+		args := make([]T, len(n.Args))
+		for i, arg := range n.Args {
+			value, err := e.eval(arg)
+			if err != nil {
+				return zero, err
+			}
+			args[i] = value
+		}
+		return e.arith.call(n, function, args)
+	}
+	return zero, newSyntaxError(ErrInvalidExpression, node.Pos(), node.String())
+}
+
+func unboundIdentifier(n *Identifier) error {
+	return newSyntaxError(fmt.Errorf("%w: %s", ErrUnboundIdentifier, n.Name), n.Position, n.Name)
+}
+
+// checkName rejects assignments and definitions that would shadow a
+// built-in constant or function.
+func (e *evaluator[T]) checkName(name string, position int) error {
+	if _, ok := functions[name]; ok || e.arith.isConstant(name) {
+		return newSyntaxError(fmt.Errorf("%w: %s", ErrReservedName, name), position, name)
+	}
+	return nil
+}
+
+func (e *evaluator[T]) define(definition *FunctionDef) error {
+	if err := e.checkName(definition.Name, definition.Position); err != nil {
+		return err
+	}
+	for _, param := range definition.Params {
+		if err := e.checkName(param, definition.Position); err != nil {
+			return err
+		}
+	}
+	e.defined[definition.Name] = definition
+	return nil
+}
+
+func (e *evaluator[T]) callDefined(n *Call, definition *FunctionDef) (T, error) {
+	var zero T
+	if len(n.Args) < len(definition.Params) {
+		return zero, newSyntaxError(ErrTooFewArguments, n.Position, n.Name)
+	}
+	if len(n.Args) > len(definition.Params) {
+		return zero, newSyntaxError(ErrTooManyArguments, n.Position, n.Name)
+	}
+	if e.depth >= MaxCallDepth {
+		return zero, newSyntaxError(ErrRecursionDepth, n.Position, n.Name)
+	}
+	// The work between two calls is bounded by the size of the expression,
+	// so the steps are only checked here.
+	if e.steps > MaxSteps {
+		return zero, newSyntaxError(ErrTooManySteps, n.Position, n.Name)
+	}
+	frame := make(map[string]T, len(n.Args))
+	for i, arg := range n.Args {
+		value, err := e.eval(arg)
+		if err != nil {
+			return zero, err
+		}
+		frame[definition.Params[i]] = value
+	}
+	caller := e.frame
+	e.frame = frame
+	e.depth++
+	result, err := e.eval(definition.Body)
+	e.frame = caller
+	e.depth--
+	return result, err
+}
@@ -0,0 +1,120 @@
+package calculator
+
+import (
+	"math"
+)
+
+type floatArithmetic struct{}
+
+func (floatArithmetic) number(n *Number) (float64, error) {
+	if n.Imaginary {
+		return 0, newSyntaxError(ErrUnsupportedInMode, n.Position, n.String())
+	}
+	if math.IsInf(n.Value, 0) {
+		return 0, newSyntaxError(ErrConvertingToFloat64, n.Position, n.String(), tokenNumber.String())
+	}
+	return n.Value, nil
+}
+
+func (floatArithmetic) isConstant(name string) bool {
+	return isBuiltinConstant(name)
+}
+
+func (floatArithmetic) constant(n *Identifier) (float64, error) {
+	return constants[n.Name], nil
+}
+
+func (floatArithmetic) variable(n *Identifier, value float64) (float64, error) {
+	return value, nil
+}
+
+func (floatArithmetic) unary(n *UnaryOp, x float64) (float64, error) {
+	switch n.Op {
+	case "+":
+		return x, nil
+	case "-":
+		return -x, nil
+	}
+	return 0, newSyntaxError(ErrUndefinedOperand, n.Position, n.Op)
+}
+
+func (floatArithmetic) binary(n *BinaryOp, left, right float64) (float64, error) {
+	var result float64
+	switch n.Op {
+	case "+":
+		result = left + right
+	case "-":
+		result = left - right
+	case "*":
+		result = left * right
+	case "/":
+		if right == 0 {
+			return 0, newSyntaxError(ErrDivisionByZero, n.Position, n.Op)
+		}
+		result = left / right
+	case "//":
+		if right == 0 {
+			return 0, newSyntaxError(ErrDivisionByZero, n.Position, n.Op)
+		}
+		result = math.Floor(left / right)
+	case "%":
+		if right == 0 {
+			return 0, newSyntaxError(ErrModuloByZero, n.Position, n.Op)
+		}
+		// The remainder takes the sign of the divisor, so that it agrees
+		// with the floored "//".
+		remainder := math.Mod(left, right)
+		if remainder != 0 && (remainder < 0) != (right < 0) {
+			remainder += right
+		}
+		return remainder, nil
+	case "==":
+		return floatArithmetic{}.boolean(left == right), nil
+	case "!=":
+		return floatArithmetic{}.boolean(left != right), nil
+	case "<":
+		return floatArithmetic{}.boolean(left < right), nil
+	case "<=":
+		return floatArithmetic{}.boolean(left <= right), nil
+	case ">":
+		return floatArithmetic{}.boolean(left > right), nil
+	case ">=":
+		return floatArithmetic{}.boolean(left >= right), nil
+	case "^":
+		result = math.Pow(left, right)
+		if math.IsNaN(result) || (left == 0 && right < 0) {
+			return 0, newSyntaxError(ErrInvalidPower, n.Position, n.Op)
+		}
+	default:
+		return 0, newSyntaxError(ErrUndefinedOperand, n.Position, n.Op)
+	}
+	return checkFloat(n, result)
+}
+
+// checkFloat reports a result that does not fit in float64 as ErrOverflow
+// at the operator n.
+func checkFloat(n *BinaryOp, result float64) (float64, error) {
+	if math.IsInf(result, 0) {
+		return 0, newSyntaxError(ErrOverflow, n.Position, n.Op)
+	}
+	return result, nil
+}
+
+func (floatArithmetic) call(n *Call, function *Function, args []float64) (float64, error) {
+	result := function.call(args)
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, newSyntaxError(ErrFunctionDomain, n.Position, n.Name)
+	}
+	return result, nil
+}
+
+func (floatArithmetic) truth(x float64) bool {
+	return x != 0
+}
+
+func (floatArithmetic) boolean(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
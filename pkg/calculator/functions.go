@@ -0,0 +1,129 @@
+package calculator
+
+import (
+	"math"
+	"sort"
+)
+
+// Variadic is the MaxArgs value of functions accepting any number of arguments.
+const Variadic = -1
+
+type Function struct {
+	Name        string
+	Description string
+	MinArgs     int
+	MaxArgs     int
+	call        func(args []float64) float64
+}
+
+func unary(f func(float64) float64) func([]float64) float64 {
+	return func(args []float64) float64 {
+		return f(args[0])
+	}
+}
+
+func binary(f func(float64, float64) float64) func([]float64) float64 {
+	return func(args []float64) float64 {
+		return f(args[0], args[1])
+	}
+}
+
+var functions = map[string]*Function{}
+
+func register(name string, description string, min_args int, max_args int, call func([]float64) float64) {
+	functions[name] = &Function{Name: name, Description: description, MinArgs: min_args, MaxArgs: max_args, call: call}
+}
+
+func init() {
+	register("sin", "sine of x (radians)", 1, 1, unary(math.Sin))
+	register("cos", "cosine of x (radians)", 1, 1, unary(math.Cos))
+	register("tan", "tangent of x (radians)", 1, 1, unary(math.Tan))
+	register("asin", "arcsine of x", 1, 1, unary(math.Asin))
+	register("acos", "arccosine of x", 1, 1, unary(math.Acos))
+	register("atan", "arctangent of x", 1, 1, unary(math.Atan))
+	register("atan2", "arctangent of y/x using the signs of both", 2, 2, binary(math.Atan2))
+	register("sinh", "hyperbolic sine of x", 1, 1, unary(math.Sinh))
+	register("cosh", "hyperbolic cosine of x", 1, 1, unary(math.Cosh))
+	register("tanh", "hyperbolic tangent of x", 1, 1, unary(math.Tanh))
+	register("sqrt", "square root of x", 1, 1, unary(math.Sqrt))
+	register("cbrt", "cube root of x", 1, 1, unary(math.Cbrt))
+	register("exp", "e to the power of x", 1, 1, unary(math.Exp))
+	register("ln", "natural logarithm of x", 1, 1, unary(math.Log))
+	register("log", "logarithm of x to base 10, or to the base given as the second argument", 1, 2, func(args []float64) float64 {
+		if len(args) == 2 {
+			return math.Log(args[0]) / math.Log(args[1])
+		}
+		return math.Log10(args[0])
+	})
+	register("log2", "logarithm of x to base 2", 1, 1, unary(math.Log2))
+	register("abs", "absolute value of x", 1, 1, unary(math.Abs))
+	register("floor", "greatest integer not greater than x", 1, 1, unary(math.Floor))
+	register("ceil", "least integer not less than x", 1, 1, unary(math.Ceil))
+	register("round", "x rounded to the nearest integer, half away from zero", 1, 1, unary(math.Round))
+	register("trunc", "integer part of x", 1, 1, unary(math.Trunc))
+	register("sign", "sign of x: -1, 0 or 1", 1, 1, func(args []float64) float64 {
+		switch {
+		case args[0] > 0:
+			return 1
+		case args[0] < 0:
+			return -1
+		}
+		return 0
+	})
+	register("pow", "x to the power of y", 2, 2, binary(math.Pow))
+	register("hypot", "square root of x*x + y*y", 2, 2, binary(math.Hypot))
+	register("re", "real part of x", 1, 1, unary(func(x float64) float64 { return x }))
+	register("im", "imaginary part of x", 1, 1, unary(func(x float64) float64 { return 0 }))
+	register("conj", "complex conjugate of x", 1, 1, unary(func(x float64) float64 { return x }))
+	register("arg", "argument (phase) of x", 1, 1, unary(func(x float64) float64 { return math.Atan2(0, x) }))
+	register("min", "smallest of the arguments", 1, Variadic, func(args []float64) float64 {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result
+	})
+	register("max", "largest of the arguments", 1, Variadic, func(args []float64) float64 {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result
+	})
+	register("sum", "sum of the arguments", 1, Variadic, func(args []float64) float64 {
+		var result float64 = 0
+		for _, arg := range args {
+			result += arg
+		}
+		return result
+	})
+	register("avg", "arithmetic mean of the arguments", 1, Variadic, func(args []float64) float64 {
+		var result float64 = 0
+		for _, arg := range args {
+			result += arg
+		}
+		return result / float64(len(args))
+	})
+}
+
+// Functions returns the built-in functions sorted by name.
+func Functions() []Function {
+	result := make([]Function, 0, len(functions))
+	for _, function := range functions {
+		result = append(result, *function)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (f *Function) checkArity(call *Call) error {
+	if len(call.Args) < f.MinArgs {
+		return newSyntaxError(ErrTooFewArguments, call.Position, call.Name)
+	}
+	if f.MaxArgs != Variadic && len(call.Args) > f.MaxArgs {
+		return newSyntaxError(ErrTooManyArguments, call.Position, call.Name)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package calculator
+
+import (
+	"math"
+	"math/big"
+	"strings"
+)
+
+const integerBits = 64
+
+// intArithmetic computes with 64-bit integers, signed or unsigned. Values
+// are held in big.Int so every result can be checked against the range of
+// the type instead of silently wrapping around.
+type intArithmetic struct {
+	unsigned bool
+}
+
+func (a intArithmetic) min() *big.Int {
+	if a.unsigned {
+		return new(big.Int)
+	}
+	return new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), integerBits-1))
+}
+
+func (a intArithmetic) max() *big.Int {
+	bits := uint(integerBits - 1)
+	if a.unsigned {
+		bits = integerBits
+	}
+	one := big.NewInt(1)
+	return new(big.Int).Sub(new(big.Int).Lsh(one, bits), one)
+}
+
+func (a intArithmetic) check(x *big.Int, position int, token string) (*big.Int, error) {
+	if x.Cmp(a.min()) < 0 || x.Cmp(a.max()) > 0 {
+		return nil, newSyntaxError(ErrIntegerOverflow, position, token)
+	}
+	return x, nil
+}
+
+func (a intArithmetic) number(n *Number) (*big.Int, error) {
+	value, err := parseInteger(n)
+	if err != nil {
+		return nil, err
+	}
+	return a.check(value, n.Position, n.String())
+}
+
+func (a intArithmetic) negativeNumber(n *UnaryOp, literal *Number) (*big.Int, error) {
+	value, err := parseInteger(literal)
+	if err != nil {
+		return nil, err
+	}
+	return a.check(value.Neg(value), n.Position, n.Op)
+}
+
+// parseInteger reads the literal of n without checking its range.
+func parseInteger(n *Number) (*big.Int, error) {
+	if n.Imaginary {
+		return nil, newSyntaxError(ErrUnsupportedInMode, n.Position, n.String())
+	}
+	literal := strings.ReplaceAll(n.String(), "_", "")
+	// Only the 0x and 0b prefixes set the base; a leading zero does not
+	// make the literal octal, as in the other modes.
+	base := 10
+	if len(literal) > 1 && literal[0] == '0' && strings.ContainsRune("xXbB", rune(literal[1])) {
+		base = 0
+	}
+	value, ok := new(big.Int).SetString(literal, base)
+	if !ok {
+		rational, ok := new(big.Rat).SetString(literal)
+		if !ok || !rational.IsInt() {
+			return nil, newSyntaxError(ErrNotInteger, n.Position, n.String())
+		}
+		value = rational.Num()
+	}
+	return value, nil
+}
+
+func (a intArithmetic) isConstant(name string) bool {
+	return isBuiltinConstant(name)
+}
+
+func (a intArithmetic) constant(n *Identifier) (*big.Int, error) {
+	return nil, newSyntaxError(ErrNotInteger, n.Position, n.Name)
+}
+
+func (a intArithmetic) variable(n *Identifier, value float64) (*big.Int, error) {
+	if math.IsInf(value, 0) || math.Trunc(value) != value {
+		return nil, newSyntaxError(ErrNotInteger, n.Position, n.Name)
+	}
+	integer, _ := big.NewFloat(value).Int(nil)
+	return a.check(integer, n.Position, n.Name)
+}
+
+func (a intArithmetic) unary(n *UnaryOp, x *big.Int) (*big.Int, error) {
+	switch n.Op {
+	case "+":
+		return x, nil
+	case "-":
+		return a.check(new(big.Int).Neg(x), n.Position, n.Op)
+	case "~":
+		if a.unsigned {
+			return new(big.Int).Xor(x, a.max()), nil
+		}
+		return new(big.Int).Not(x), nil
+	}
+	return nil, newSyntaxError(ErrUndefinedOperand, n.Position, n.Op)
+}
+
+func (a intArithmetic) binary(n *BinaryOp, left, right *big.Int) (*big.Int, error) {
+	result := new(big.Int)
+	switch n.Op {
+	case "+":
+		result.Add(left, right)
+	case "-":
+		result.Sub(left, right)
+	case "*":
+		result.Mul(left, right)
+	case "/":
+		if right.Sign() == 0 {
+			return nil, newSyntaxError(ErrDivisionByZero, n.Position, n.Op)
+		}
+		result.Quo(left, right)
+	case "//":
+		if right.Sign() == 0 {
+			return nil, newSyntaxError(ErrDivisionByZero, n.Position, n.Op)
+		}
+		remainder := new(big.Int)
+		result.QuoRem(left, right, remainder)
+		if remainder.Sign() != 0 && remainder.Sign() != right.Sign() {
+			result.Sub(result, big.NewInt(1))
+		}
+	case "%":
+		if right.Sign() == 0 {
+			return nil, newSyntaxError(ErrModuloByZero, n.Position, n.Op)
+		}
+		result.Rem(left, right)
+		if result.Sign() != 0 && result.Sign() != right.Sign() {
+			result.Add(result, right)
+		}
+	case "^":
+		if right.Sign() < 0 {
+			return nil, newSyntaxError(ErrInvalidPower, n.Position, n.Op)
+		}
+		if left.CmpAbs(big.NewInt(1)) > 0 && right.Cmp(big.NewInt(integerBits)) > 0 {
+			return nil, newSyntaxError(ErrIntegerOverflow, n.Position, n.Op)
+		}
+		result.Exp(left, right, nil)
+	case "&":
+		result.And(left, right)
+	case "|":
+		result.Or(left, right)
+	case xorOperator:
+		result.Xor(left, right)
+	case "<<", ">>":
+		if right.Sign() < 0 || right.Cmp(big.NewInt(integerBits)) >= 0 {
+			return nil, newSyntaxError(ErrInvalidShift, n.Position, n.Op)
+		}
+		if n.Op == "<<" {
+			result.Lsh(left, uint(right.Uint64()))
+		} else {
+			result.Rsh(left, uint(right.Uint64()))
+		}
+	case "==":
+		return a.boolean(left.Cmp(right) == 0), nil
+	case "!=":
+		return a.boolean(left.Cmp(right) != 0), nil
+	case "<":
+		return a.boolean(left.Cmp(right) < 0), nil
+	case "<=":
+		return a.boolean(left.Cmp(right) <= 0), nil
+	case ">":
+		return a.boolean(left.Cmp(right) > 0), nil
+	case ">=":
+		return a.boolean(left.Cmp(right) >= 0), nil
+	default:
+		return nil, newSyntaxError(ErrUndefinedOperand, n.Position, n.Op)
+	}
+	return a.check(result, n.Position, n.Op)
+}
+
+func (a intArithmetic) call(n *Call, function *Function, args []*big.Int) (*big.Int, error) {
+	result := new(big.Int)
+	switch n.Name {
+	case "abs":
+		result.Abs(args[0])
+	case "sign":
+		result.SetInt64(int64(args[0].Sign()))
+	case "floor", "ceil", "round", "trunc", "re", "conj":
+		result.Set(args[0])
+	case "min", "max":
+		result.Set(args[0])
+		for _, arg := range args[1:] {
+			if cmp := arg.Cmp(result); (n.Name == "min" && cmp < 0) || (n.Name == "max" && cmp > 0) {
+				result.Set(arg)
+			}
+		}
+	case "sum":
+		for _, arg := range args {
+			result.Add(result, arg)
+		}
+	default:
+		return nil, newSyntaxError(ErrUnsupportedInMode, n.Position, n.Name)
+	}
+	return a.check(result, n.Position, n.Name)
+}
+
+func (a intArithmetic) truth(x *big.Int) bool {
+	return x.Sign() != 0
+}
+
+func (a intArithmetic) boolean(b bool) *big.Int {
+	if b {
+		return big.NewInt(1)
+	}
+	return new(big.Int)
+}
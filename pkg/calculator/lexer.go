@@ -0,0 +1,151 @@
+package calculator
+
+import (
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenOperator
+	tokenLeftBracket
+	tokenRightBracket
+	tokenIdentifier
+	tokenComma
+	tokenSemicolon
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenNumber:
+		return "number"
+	case tokenOperator:
+		return "operator"
+	case tokenLeftBracket:
+		return "("
+	case tokenRightBracket:
+		return ")"
+	case tokenIdentifier:
+		return "identifier"
+	case tokenComma:
+		return ","
+	case tokenSemicolon:
+		return ";"
+	default:
+		return "end of expression"
+	}
+}
+
+type Token struct {
+	kind      tokenKind
+	text      string
+	num       float64
+	imaginary bool
+	pos       int
+}
+
+var longOperators = []string{"//", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||"}
+
+// xorOperator is spelled as a word, since "^" is exponentiation.
+const xorOperator = "xor"
+
+// scanLongOperator returns the two-rune operator starting at expr[index].
+func scanLongOperator(expr []rune, index int) (string, bool) {
+	if index+1 >= len(expr) {
+		return "", false
+	}
+	candidate := string(expr[index : index+2])
+	for _, operator := range longOperators {
+		if candidate == operator {
+			return operator, true
+		}
+	}
+	return "", false
+}
+
+func isOperand(char rune) bool {
+	switch char {
+	case '+', '-', '*', '/', '^', '%', '<', '>', '!', '?', ':', '&', '|', '~', '=':
+		return true
+	default:
+		return false
+	}
+}
+
+func isIdentifierPart(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+}
+
+func tokenize(expression string) ([]Token, error) {
+	var open_brackets []int
+	var tokens []Token
+	expr := []rune(expression)
+	for index := 0; index < len(expr); index++ {
+		var symbol rune = expr[index]
+		switch {
+		case unicode.IsSpace(symbol):
+			continue
+		case symbol == '(':
+			open_brackets = append(open_brackets, index)
+			tokens = append(tokens, Token{kind: tokenLeftBracket, text: "(", pos: index})
+		case symbol == ')':
+			if len(open_brackets) == 0 {
+				return nil, newSyntaxError(ErrIncorrectBracketSequence, index, ")")
+			}
+			open_brackets = open_brackets[:len(open_brackets)-1]
+			tokens = append(tokens, Token{kind: tokenRightBracket, text: ")", pos: index})
+		case symbol == ',':
+			tokens = append(tokens, Token{kind: tokenComma, text: ",", pos: index})
+		case symbol == ';':
+			tokens = append(tokens, Token{kind: tokenSemicolon, text: ";", pos: index})
+		case isOperand(symbol):
+			if operator, ok := scanLongOperator(expr, index); ok {
+				tokens = append(tokens, Token{kind: tokenOperator, text: operator, pos: index})
+				index++
+				continue
+			}
+			tokens = append(tokens, Token{kind: tokenOperator, text: string(symbol), pos: index})
+		case isNumberStart(expr, index):
+			literal, num, end, err := scanNumber(expr, index)
+			if err != nil {
+				return nil, err
+			}
+			imaginary := end < len(expr) && expr[end] == 'i' && (end+1 == len(expr) || !isIdentifierPart(expr[end+1]))
+			if imaginary {
+				literal += "i"
+				end++
+			}
+			tokens = append(tokens, Token{kind: tokenNumber, text: literal, num: num, imaginary: imaginary, pos: index})
+			index = end - 1
+		case unicode.IsLetter(symbol) || symbol == '_':
+			last_letter_index := index + 1
+			for last_letter_index < len(expr) && isIdentifierPart(expr[last_letter_index]) {
+				last_letter_index++
+			}
+			text := string(expr[index:last_letter_index])
+			if text == xorOperator {
+				tokens = append(tokens, Token{kind: tokenOperator, text: text, pos: index})
+			} else {
+				tokens = append(tokens, Token{kind: tokenIdentifier, text: text, pos: index})
+			}
+			index = last_letter_index - 1
+		default:
+			return nil, newSyntaxError(ErrUndefinedOperand, index, string(symbol))
+		}
+	}
+	if len(open_brackets) != 0 {
+		return nil, newSyntaxError(ErrIncorrectBracketSequence, open_brackets[len(open_brackets)-1], "(", tokenRightBracket.String())
+	}
+	return append(tokens, Token{kind: tokenEOF, pos: len(expr)}), nil
+}
+
+// CountTokens returns the number of tokens of expression.
+func CountTokens(expression string) (int, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return 0, err
+	}
+	return len(tokens) - 1, nil
+}
@@ -0,0 +1,140 @@
+package calculator
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// Mode selects the number system an expression is evaluated in.
+type Mode string
+
+const (
+	ModeFloat    Mode = "float"
+	ModeDecimal  Mode = "decimal"
+	ModeRational Mode = "rational"
+	ModeComplex  Mode = "complex"
+	ModeInteger  Mode = "integer"
+)
+
+type Options struct {
+	Mode Mode
+	// Precision is the number of significant decimal digits kept in
+	// ModeDecimal, DefaultPrecision if zero.
+	Precision uint
+	// Unsigned makes ModeInteger compute with uint64 instead of int64.
+	Unsigned  bool
+	Variables map[string]float64
+}
+
+// Result is the value of an expression. Float is set in every mode, as
+// the value itself or its closest float64 approximation (the real part in
+// ModeComplex). Boolean marks results of comparisons and logical
+// operators, which are 1 for true and 0 for false.
+type Result struct {
+	Mode     Mode
+	Float    float64
+	Decimal  *big.Float
+	Rational *big.Rat
+	Complex  complex128
+	Integer  *big.Int
+	Boolean  bool
+	digits   uint
+}
+
+func (r Result) String() string {
+	switch r.Mode {
+	case ModeDecimal:
+		return r.Decimal.Text('g', int(r.digits))
+	case ModeRational:
+		return r.Rational.RatString()
+	case ModeComplex:
+		return strconv.FormatComplex(r.Complex, 'g', -1, 128)
+	case ModeInteger:
+		return r.Integer.String()
+	default:
+		return strconv.FormatFloat(r.Float, 'g', -1, 64)
+	}
+}
+
+// Text formats a ModeInteger result in base 2, 8, 10 or 16, with the
+// 0b, 0o or 0x prefix for the non-decimal ones.
+func (r Result) Text(base int) string {
+	prefix := map[int]string{2: "0b", 8: "0o", 16: "0x"}[base]
+	if r.Integer.Sign() < 0 {
+		return "-" + prefix + new(big.Int).Neg(r.Integer).Text(base)
+	}
+	return prefix + r.Integer.Text(base)
+}
+
+func (o Options) validate() error {
+	switch o.Mode {
+	case "", ModeFloat, ModeRational, ModeComplex, ModeInteger:
+	case ModeDecimal:
+		if o.Precision > MaxPrecision {
+			return ErrInvalidPrecision
+		}
+	default:
+		return ErrUnknownMode
+	}
+	return nil
+}
+
+// Evaluate parses expression and computes it in the mode given by options.
+func Evaluate(expression string, options Options) (Result, error) {
+	if err := options.validate(); err != nil {
+		return Result{}, err
+	}
+	node, err := Parse(expression)
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := evaluateNode(node, options)
+	if err != nil {
+		return Result{}, err
+	}
+	result.Boolean = IsBoolean(node)
+	return result, nil
+}
+
+func evaluateNode(node Node, options Options) (Result, error) {
+	switch options.Mode {
+	case ModeDecimal:
+		digits := options.Precision
+		if digits == 0 {
+			digits = DefaultPrecision
+		}
+		arith := ratArithmetic{digits: digits}
+		value, err := evaluate[*big.Rat](node, arith, options.Variables)
+		if err != nil {
+			return Result{}, err
+		}
+		approximation, _ := value.Float64()
+		return Result{Mode: ModeDecimal, Float: approximation, Decimal: arith.round(value), digits: digits}, nil
+	case ModeRational:
+		value, err := evaluate[*big.Rat](node, ratArithmetic{exact: true}, options.Variables)
+		if err != nil {
+			return Result{}, err
+		}
+		approximation, _ := value.Float64()
+		return Result{Mode: ModeRational, Float: approximation, Rational: value}, nil
+	case ModeComplex:
+		value, err := evaluate[complex128](node, complexArithmetic{}, options.Variables)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{Mode: ModeComplex, Float: real(value), Complex: value}, nil
+	case ModeInteger:
+		value, err := evaluate[*big.Int](node, intArithmetic{unsigned: options.Unsigned}, options.Variables)
+		if err != nil {
+			return Result{}, err
+		}
+		approximation, _ := new(big.Float).SetInt(value).Float64()
+		return Result{Mode: ModeInteger, Float: approximation, Integer: value}, nil
+	default:
+		value, err := EvalWithVariables(node, options.Variables)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{Mode: ModeFloat, Float: value}, nil
+	}
+}
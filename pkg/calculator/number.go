@@ -0,0 +1,116 @@
+package calculator
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+func isDecimalDigit(char rune) bool {
+	return char >= '0' && char <= '9'
+}
+
+func isHexDigit(char rune) bool {
+	return isDecimalDigit(char) || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')
+}
+
+func isBinaryDigit(char rune) bool {
+	return char == '0' || char == '1'
+}
+
+func isNumberStart(expr []rune, index int) bool {
+	if isDecimalDigit(expr[index]) {
+		return true
+	}
+	return expr[index] == '.' && index+1 < len(expr) && isDecimalDigit(expr[index+1])
+}
+
+// checkSeparators reports the offset of the first "_" in digits that does
+// not stand between two digits accepted by isDigit, or -1.
+func checkSeparators(digits []rune, isDigit func(rune) bool) int {
+	for i, char := range digits {
+		if char != '_' {
+			continue
+		}
+		if i == 0 || i == len(digits)-1 || !isDigit(digits[i-1]) || !isDigit(digits[i+1]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// scanNumber reads the number literal starting at expr[index] and returns
+// it together with its value and the index right after it.
+func scanNumber(expr []rune, index int) (string, float64, int, error) {
+	if expr[index] == '0' && index+1 < len(expr) {
+		switch expr[index+1] {
+		case 'x', 'X':
+			return scanPrefixedNumber(expr, index, 16, isHexDigit, "hex digit")
+		case 'b', 'B':
+			return scanPrefixedNumber(expr, index, 2, isBinaryDigit, "binary digit")
+		}
+	}
+	end := index
+	for end < len(expr) && (isDecimalDigit(expr[end]) || expr[end] == '.' || expr[end] == '_') {
+		end++
+	}
+	if end < len(expr) && (expr[end] == 'e' || expr[end] == 'E') {
+		exponent := end + 1
+		if exponent < len(expr) && (expr[exponent] == '+' || expr[exponent] == '-') {
+			exponent++
+		}
+		switch {
+		case exponent < len(expr) && isDecimalDigit(expr[exponent]):
+			end = exponent
+			for end < len(expr) && (isDecimalDigit(expr[end]) || expr[end] == '_') {
+				end++
+			}
+		case exponent == end+1 && exponent < len(expr) && isIdentifierPart(expr[exponent]):
+			// "2exp(1)": the letter starts an identifier, not an exponent.
+		default:
+			literal := string(expr[index:exponent])
+			return "", 0, 0, newSyntaxError(ErrMalformedExponent, index, literal, "digit")
+		}
+	}
+	literal := string(expr[index:end])
+	if offset := checkSeparators(expr[index:end], isDecimalDigit); offset != -1 {
+		return "", 0, 0, newSyntaxError(ErrMisplacedSeparator, index+offset, literal, "digit")
+	}
+	// Literals out of the float64 range are kept with an infinite value:
+	// the exact modes read them from the literal, the others reject them.
+	num, err := strconv.ParseFloat(strings.ReplaceAll(literal, "_", ""), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return "", 0, 0, newSyntaxError(ErrConvertingToFloat64, index, literal, tokenNumber.String())
+	}
+	return literal, num, end, nil
+}
+
+func scanPrefixedNumber(expr []rune, index int, base int, isDigit func(rune) bool, digit_name string) (string, float64, int, error) {
+	start := index + 2
+	end := start
+	for end < len(expr) && (isIdentifierPart(expr[end]) || expr[end] == '.') {
+		end++
+	}
+	literal := string(expr[index:end])
+	digits := expr[start:end]
+	if len(digits) == 0 {
+		return "", 0, 0, newSyntaxError(ErrInvalidDigit, end, literal, digit_name)
+	}
+	for i, char := range digits {
+		if char != '_' && !isDigit(char) {
+			return "", 0, 0, newSyntaxError(ErrInvalidDigit, start+i, literal, digit_name)
+		}
+	}
+	if offset := checkSeparators(digits, isDigit); offset != -1 {
+		return "", 0, 0, newSyntaxError(ErrMisplacedSeparator, start+offset, literal, digit_name)
+	}
+	num, err := strconv.ParseUint(strings.ReplaceAll(string(digits), "_", ""), base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return literal, math.Inf(1), end, nil
+	}
+	if err != nil {
+		return "", 0, 0, newSyntaxError(ErrConvertingToFloat64, index, literal, tokenNumber.String())
+	}
+	return literal, float64(num), end, nil
+}
@@ -0,0 +1,297 @@
+package calculator
+
+const (
+	ternaryPrecedence = 1
+	unaryPrecedence   = 12
+)
+
+var operandStart = []string{tokenNumber.String(), tokenIdentifier.String(), tokenLeftBracket.String()}
+
+var binaryPrecedence = map[string]int{
+	"||":  2,
+	"&&":  3,
+	"==":  4,
+	"!=":  4,
+	"<":   5,
+	"<=":  5,
+	">":   5,
+	">=":  5,
+	"|":   6,
+	"xor": 7,
+	"&":   8,
+	"<<":  9,
+	">>":  9,
+	"+":   10,
+	"-":   10,
+	"*":   11,
+	"/":   11,
+	"//":  11,
+	"%":   11,
+	"^":   13,
+}
+
+var rightAssociative = map[string]bool{
+	"^": true,
+}
+
+type parser struct {
+	tokens      []Token
+	index       int
+	last_binary int
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.index]
+}
+
+func (p *parser) next() Token {
+	token := p.tokens[p.index]
+	if token.kind != tokenEOF {
+		p.index++
+	}
+	return token
+}
+
+func (p *parser) errorAt(token Token, err error, expected ...string) error {
+	return newSyntaxError(err, token.pos, token.text, expected...)
+}
+
+func (p *parser) previous() (Token, bool) {
+	if p.index == 0 {
+		return Token{}, false
+	}
+	return p.tokens[p.index-1], true
+}
+
+// implicitMultiplication reports whether the next token starts an operand
+// glued to the previous one, as in "(7)(5)" or "(1+1)3".
+func (p *parser) implicitMultiplication() bool {
+	token := p.peek()
+	prev, ok := p.previous()
+	if !ok {
+		return false
+	}
+	switch token.kind {
+	case tokenLeftBracket:
+		return prev.kind == tokenRightBracket || prev.kind == tokenNumber
+	case tokenNumber:
+		return prev.kind == tokenRightBracket
+	case tokenIdentifier:
+		return prev.kind == tokenRightBracket || prev.kind == tokenNumber
+	default:
+		return false
+	}
+}
+
+func (p *parser) parseExpression(min_precedence int) (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token := p.peek()
+		op := token.text
+		if p.implicitMultiplication() {
+			op = "*"
+		} else if token.kind != tokenOperator {
+			return left, nil
+		}
+		if op == "?" {
+			if ternaryPrecedence < min_precedence {
+				return left, nil
+			}
+			conditional, err := p.parseConditional(left)
+			if err != nil {
+				return nil, err
+			}
+			left = conditional
+			continue
+		}
+		precedence, ok := binaryPrecedence[op]
+		if !ok || precedence < min_precedence {
+			return left, nil
+		}
+		if op == token.text {
+			p.last_binary = p.index
+			p.next()
+		}
+		next_precedence := precedence + 1
+		if rightAssociative[op] {
+			next_precedence = precedence
+		}
+		right, err := p.parseExpression(next_precedence)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryOp{Op: op, Left: left, Right: right, Position: token.pos}
+	}
+}
+
+// parseConditional parses the rest of "cond ? then : else" after cond.
+// The else branch binds to the right, so a ? b : c ? d : e nests in it.
+func (p *parser) parseConditional(condition Node) (Node, error) {
+	question := p.next()
+	then, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	if colon := p.next(); colon.text != ":" {
+		return nil, p.errorAt(colon, ErrInvalidExpression, ":")
+	}
+	otherwise, err := p.parseExpression(ternaryPrecedence)
+	if err != nil {
+		return nil, err
+	}
+	return &Conditional{Condition: condition, Then: then, Else: otherwise, Position: question.pos}, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	token := p.peek()
+	if token.kind != tokenOperator {
+		return p.parsePrimary()
+	}
+	switch token.text {
+	case "!", "~":
+	case "+", "-":
+		// A sign right after binary "+" or "-" is rejected: "2++3" or "2--3"
+		// is far more likely a typo than an intended unary operator.
+		if prev, ok := p.previous(); ok && p.last_binary == p.index-1 && (prev.text == "+" || prev.text == "-") {
+			return nil, p.errorAt(token, ErrMultipleOperands, operandStart...)
+		}
+	default:
+		return nil, p.errorAt(token, ErrMultipleOperands, operandStart...)
+	}
+	p.next()
+	operand, err := p.parseExpression(unaryPrecedence)
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryOp{Op: token.text, Operand: operand, Position: token.pos}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	token := p.next()
+	switch token.kind {
+	case tokenNumber:
+		return &Number{Value: token.num, Imaginary: token.imaginary, Literal: token.text, Position: token.pos}, nil
+	case tokenLeftBracket:
+		inner, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRightBracket {
+			return nil, p.errorAt(closing, ErrIncorrectBracketSequence, tokenOperator.String(), tokenRightBracket.String())
+		}
+		return &Group{Inner: inner, Position: token.pos}, nil
+	case tokenIdentifier:
+		if p.peek().kind != tokenLeftBracket {
+			return &Identifier{Name: token.text, Position: token.pos}, nil
+		}
+		p.next()
+		args, err := p.parseArguments()
+		if err != nil {
+			return nil, err
+		}
+		return &Call{Name: token.text, Args: args, Position: token.pos}, nil
+	default:
+		return nil, p.errorAt(token, ErrInvalidExpression, operandStart...)
+	}
+}
+
+func (p *parser) parseArguments() ([]Node, error) {
+	var args []Node
+	if p.peek().kind == tokenRightBracket {
+		p.next()
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		switch token := p.next(); token.kind {
+		case tokenComma:
+			continue
+		case tokenRightBracket:
+			return args, nil
+		default:
+			return nil, p.errorAt(token, ErrInvalidExpression, tokenOperator.String(), tokenComma.String(), tokenRightBracket.String())
+		}
+	}
+}
+
+// parseStatement parses an expression, an assignment "name = expr" or a
+// function definition "name(params) = expr". The left side of "=" is
+// parsed as an expression first and then checked to be a valid target.
+func (p *parser) parseStatement() (Node, error) {
+	target, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	assign := p.peek()
+	if assign.text != "=" {
+		return target, nil
+	}
+	p.next()
+	value, err := p.parseExpression(0)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case *Identifier:
+		return &Assignment{Name: t.Name, Value: value, Position: t.Position}, nil
+	case *Call:
+		params := make([]string, len(t.Args))
+		seen := make(map[string]bool)
+		for i, arg := range t.Args {
+			param, ok := arg.(*Identifier)
+			if !ok || seen[param.Name] {
+				return nil, newSyntaxError(ErrInvalidDefinition, arg.Pos(), arg.String(), tokenIdentifier.String())
+			}
+			seen[param.Name] = true
+			params[i] = param.Name
+		}
+		return &FunctionDef{Name: t.Name, Params: params, Body: value, Position: t.Position}, nil
+	}
+	return nil, p.errorAt(assign, ErrInvalidDefinition, tokenOperator.String(), tokenSemicolon.String(), tokenEOF.String())
+}
+
+// Parse builds the expression tree for the given expression. Several
+// statements separated by ";" are returned as a Sequence.
+func Parse(expression string) (Node, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	return parseTokens(tokens)
+}
+
+func parseTokens(tokens []Token) (Node, error) {
+	if len(tokens) == 1 {
+		return nil, newSyntaxError(ErrInvalidExpression, 0, "", operandStart...)
+	}
+	p := parser{tokens: tokens, last_binary: -1}
+	sequence := &Sequence{}
+	for {
+		statement, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		sequence.Statements = append(sequence.Statements, statement)
+		token := p.next()
+		if token.kind == tokenSemicolon && p.peek().kind == tokenEOF {
+			token = p.next()
+		}
+		if token.kind == tokenEOF {
+			break
+		}
+		if token.kind != tokenSemicolon {
+			return nil, p.errorAt(token, ErrInvalidExpression, tokenOperator.String(), tokenSemicolon.String(), tokenEOF.String())
+		}
+	}
+	if len(sequence.Statements) == 1 {
+		return sequence.Statements[0], nil
+	}
+	return sequence, nil
+}
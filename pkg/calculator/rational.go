@@ -0,0 +1,309 @@
+package calculator
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultPrecision = 50
+	MaxPrecision     = 1000
+	// maxExactExponent bounds the exponent of powers computed exactly.
+	maxExactExponent = 100000
+	// maxExactBits bounds the size of the numerator and the denominator of
+	// exact results. Powers are checked before they are computed, as their
+	// size is the size of the base times the exponent.
+	maxExactBits = 1 << 22
+)
+
+// arctanInverse returns atan(1/n) scaled by unity, computed with the
+// Taylor series in fixed point.
+func arctanInverse(n int64, unity *big.Int) *big.Int {
+	term := new(big.Int).Quo(unity, big.NewInt(n))
+	sum := new(big.Int).Set(term)
+	square := big.NewInt(n * n)
+	part := new(big.Int)
+	for k := int64(1); term.Sign() != 0; k++ {
+		term.Quo(term, square)
+		part.Quo(term, big.NewInt(2*k+1))
+		if k%2 == 1 {
+			sum.Sub(sum, part)
+		} else {
+			sum.Add(sum, part)
+		}
+	}
+	return sum
+}
+
+type constantKey struct {
+	name string
+	prec uint
+}
+
+// decimalConstants caches the constants by name and precision.
+var decimalConstants sync.Map
+
+// decimalConstant returns the constant name with prec bits after the
+// binary point: pi by Machin's formula 16 atan(1/5) - 4 atan(1/239), e as
+// the sum of 1/k!.
+func decimalConstant(name string, prec uint) *big.Rat {
+	key := constantKey{name, prec}
+	if value, ok := decimalConstants.Load(key); ok {
+		return new(big.Rat).Set(value.(*big.Rat))
+	}
+	unity := new(big.Int).Lsh(big.NewInt(1), prec)
+	value := new(big.Int)
+	switch name {
+	case "pi":
+		value.Mul(arctanInverse(5, unity), big.NewInt(16))
+		value.Sub(value, new(big.Int).Mul(arctanInverse(239, unity), big.NewInt(4)))
+	case "e":
+		term := new(big.Int).Set(unity)
+		for k := int64(1); term.Sign() != 0; k++ {
+			value.Add(value, term)
+			term.Quo(term, big.NewInt(k))
+		}
+	}
+	result := new(big.Rat).SetFrac(value, unity)
+	decimalConstants.Store(key, result)
+	return new(big.Rat).Set(result)
+}
+
+// ratArithmetic computes exactly with rationals, so 0.1+0.2 is 0.3.
+// Irrational values (square roots, constants) are rejected when exact is
+// set, and otherwise approximated with digits significant decimal digits
+// and guard bits on top.
+type ratArithmetic struct {
+	digits uint
+	exact  bool
+}
+
+func (d ratArithmetic) prec() uint {
+	return uint(math.Ceil(float64(d.digits)*math.Log2(10))) + 64
+}
+
+// round converts x to a binary float wide enough to print digits
+// significant decimal digits of it correctly.
+func (d ratArithmetic) round(x *big.Rat) *big.Float {
+	return new(big.Float).SetPrec(d.prec()).SetRat(x)
+}
+
+func (d ratArithmetic) number(n *Number) (*big.Rat, error) {
+	if n.Imaginary {
+		return nil, newSyntaxError(ErrUnsupportedInMode, n.Position, n.String())
+	}
+	value, ok := new(big.Rat).SetString(strings.ReplaceAll(n.String(), "_", ""))
+	if !ok {
+		return nil, newSyntaxError(ErrConvertingToFloat64, n.Position, n.String(), tokenNumber.String())
+	}
+	return value, nil
+}
+
+// exactSqrt returns the square root of a non-negative x if it is rational.
+func exactSqrt(x *big.Rat) (*big.Rat, bool) {
+	num := new(big.Int).Sqrt(x.Num())
+	den := new(big.Int).Sqrt(x.Denom())
+	root := new(big.Rat).SetFrac(num, den)
+	return root, new(big.Rat).Mul(root, root).Cmp(x) == 0
+}
+
+func (d ratArithmetic) sqrt(x *big.Rat) *big.Rat {
+	if root, ok := exactSqrt(x); ok {
+		return root
+	}
+	root, _ := new(big.Float).SetPrec(d.prec()).Sqrt(d.round(x)).Rat(nil)
+	return root
+}
+
+func (d ratArithmetic) isConstant(name string) bool {
+	return isBuiltinConstant(name)
+}
+
+func (d ratArithmetic) constant(n *Identifier) (*big.Rat, error) {
+	if d.exact {
+		return nil, newSyntaxError(ErrIrrational, n.Position, n.Name)
+	}
+	if n.Name == "phi" {
+		root := d.sqrt(big.NewRat(5, 1))
+		return root.Add(root, big.NewRat(1, 1)).Quo(root, big.NewRat(2, 1)), nil
+	}
+	return decimalConstant(n.Name, d.prec()), nil
+}
+
+func (d ratArithmetic) variable(n *Identifier, value float64) (*big.Rat, error) {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil, newSyntaxError(ErrConvertingToFloat64, n.Position, n.Name)
+	}
+	result, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', -1, 64))
+	if !ok {
+		return nil, newSyntaxError(ErrConvertingToFloat64, n.Position, n.Name)
+	}
+	return result, nil
+}
+
+func (d ratArithmetic) unary(n *UnaryOp, x *big.Rat) (*big.Rat, error) {
+	switch n.Op {
+	case "+":
+		return x, nil
+	case "-":
+		return new(big.Rat).Neg(x), nil
+	}
+	return nil, newSyntaxError(ErrUndefinedOperand, n.Position, n.Op)
+}
+
+func floorRat(x *big.Rat) *big.Rat {
+	// Denominators are positive, so Euclidean division rounds down.
+	return new(big.Rat).SetInt(new(big.Int).Div(x.Num(), x.Denom()))
+}
+
+func truncRat(x *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Quo(x.Num(), x.Denom()))
+}
+
+// checkRat returns ErrOverflow at position if x is too large to be kept
+// exactly.
+func checkRat(x *big.Rat, position int, token string) (*big.Rat, error) {
+	if x.Num().BitLen() > maxExactBits || x.Denom().BitLen() > maxExactBits {
+		return nil, newSyntaxError(ErrOverflow, position, token)
+	}
+	return x, nil
+}
+
+func (d ratArithmetic) pow(n *BinaryOp, x, y *big.Rat) (*big.Rat, error) {
+	if !y.IsInt() {
+		if d.exact {
+			return nil, newSyntaxError(ErrIrrational, n.Position, n.Op)
+		}
+		return nil, newSyntaxError(ErrUnsupportedInMode, n.Position, n.Op)
+	}
+	if !y.Num().IsInt64() || y.Num().Int64() > maxExactExponent || y.Num().Int64() < -maxExactExponent {
+		return nil, newSyntaxError(ErrInvalidPower, n.Position, n.Op)
+	}
+	exponent := y.Num().Int64()
+	if x.Sign() == 0 && exponent < 0 {
+		return nil, newSyntaxError(ErrInvalidPower, n.Position, n.Op)
+	}
+	negative := exponent < 0
+	if negative {
+		exponent = -exponent
+	}
+	if int64(x.Num().BitLen())*exponent > maxExactBits || int64(x.Denom().BitLen())*exponent > maxExactBits {
+		return nil, newSyntaxError(ErrOverflow, n.Position, n.Op)
+	}
+	e := big.NewInt(exponent)
+	result := new(big.Rat).SetFrac(new(big.Int).Exp(x.Num(), e, nil), new(big.Int).Exp(x.Denom(), e, nil))
+	if negative {
+		result.Inv(result)
+	}
+	return result, nil
+}
+
+func (d ratArithmetic) binary(n *BinaryOp, left, right *big.Rat) (*big.Rat, error) {
+	switch n.Op {
+	case "+":
+		return checkRat(new(big.Rat).Add(left, right), n.Position, n.Op)
+	case "-":
+		return checkRat(new(big.Rat).Sub(left, right), n.Position, n.Op)
+	case "*":
+		return checkRat(new(big.Rat).Mul(left, right), n.Position, n.Op)
+	case "/":
+		if right.Sign() == 0 {
+			return nil, newSyntaxError(ErrDivisionByZero, n.Position, n.Op)
+		}
+		return checkRat(new(big.Rat).Quo(left, right), n.Position, n.Op)
+	case "//":
+		if right.Sign() == 0 {
+			return nil, newSyntaxError(ErrDivisionByZero, n.Position, n.Op)
+		}
+		return checkRat(floorRat(new(big.Rat).Quo(left, right)), n.Position, n.Op)
+	case "%":
+		if right.Sign() == 0 {
+			return nil, newSyntaxError(ErrModuloByZero, n.Position, n.Op)
+		}
+		quotient := floorRat(new(big.Rat).Quo(left, right))
+		return checkRat(quotient.Sub(left, quotient.Mul(quotient, right)), n.Position, n.Op)
+	case "==":
+		return d.boolean(left.Cmp(right) == 0), nil
+	case "!=":
+		return d.boolean(left.Cmp(right) != 0), nil
+	case "<":
+		return d.boolean(left.Cmp(right) < 0), nil
+	case "<=":
+		return d.boolean(left.Cmp(right) <= 0), nil
+	case ">":
+		return d.boolean(left.Cmp(right) > 0), nil
+	case ">=":
+		return d.boolean(left.Cmp(right) >= 0), nil
+	case "^":
+		return d.pow(n, left, right)
+	}
+	return nil, newSyntaxError(ErrUndefinedOperand, n.Position, n.Op)
+}
+
+func (d ratArithmetic) call(n *Call, function *Function, args []*big.Rat) (*big.Rat, error) {
+	switch n.Name {
+	case "abs":
+		return new(big.Rat).Abs(args[0]), nil
+	case "sign":
+		return big.NewRat(int64(args[0].Sign()), 1), nil
+	case "floor":
+		return floorRat(args[0]), nil
+	case "ceil":
+		ceil := floorRat(new(big.Rat).Neg(args[0]))
+		return ceil.Neg(ceil), nil
+	case "trunc":
+		return truncRat(args[0]), nil
+	case "round":
+		rounded := floorRat(new(big.Rat).Add(new(big.Rat).Abs(args[0]), big.NewRat(1, 2)))
+		if args[0].Sign() < 0 {
+			rounded.Neg(rounded)
+		}
+		return rounded, nil
+	case "sqrt":
+		if args[0].Sign() < 0 {
+			return nil, newSyntaxError(ErrFunctionDomain, n.Position, n.Name)
+		}
+		if root, ok := exactSqrt(args[0]); ok {
+			return root, nil
+		}
+		if d.exact {
+			return nil, newSyntaxError(ErrIrrational, n.Position, n.Name)
+		}
+		return d.sqrt(args[0]), nil
+	case "min", "max":
+		result := args[0]
+		for _, arg := range args[1:] {
+			if cmp := arg.Cmp(result); (n.Name == "min" && cmp < 0) || (n.Name == "max" && cmp > 0) {
+				result = arg
+			}
+		}
+		return result, nil
+	case "sum", "avg":
+		result := new(big.Rat)
+		for _, arg := range args {
+			result.Add(result, arg)
+		}
+		if n.Name == "avg" {
+			result.Quo(result, big.NewRat(int64(len(args)), 1))
+		}
+		return checkRat(result, n.Position, n.Name)
+	}
+	if d.exact {
+		return nil, newSyntaxError(ErrIrrational, n.Position, n.Name)
+	}
+	return nil, newSyntaxError(ErrUnsupportedInMode, n.Position, n.Name)
+}
+
+func (d ratArithmetic) truth(x *big.Rat) bool {
+	return x.Sign() != 0
+}
+
+func (d ratArithmetic) boolean(b bool) *big.Rat {
+	if b {
+		return big.NewRat(1, 1)
+	}
+	return new(big.Rat)
+}